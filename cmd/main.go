@@ -2,17 +2,26 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/Yury132/Golang-Task-4/internal/client/api"
+	"github.com/Yury132/Golang-Task-4/internal/client/dictionary"
+	"github.com/Yury132/Golang-Task-4/internal/client/learned"
 	"github.com/Yury132/Golang-Task-4/internal/config"
+	"github.com/Yury132/Golang-Task-4/internal/models"
 	"github.com/Yury132/Golang-Task-4/internal/service"
 	"github.com/Yury132/Golang-Task-4/internal/storage"
+	"github.com/Yury132/Golang-Task-4/internal/translit"
 	transport "github.com/Yury132/Golang-Task-4/internal/transport/http"
 	"github.com/Yury132/Golang-Task-4/internal/transport/http/handlers"
+	"github.com/Yury132/Golang-Task-4/internal/worker"
 	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/pressly/goose/v3"
@@ -23,6 +32,14 @@ const (
 	commandUp      = "up"
 	commandDown    = "down"
 	migrationsPath = "./internal/migrations"
+
+	// Консольные команды: go run cmd/main.go <команда> [флаги]
+	commandReenrich = "reenrich"
+
+	// Источники данных для обогащения
+	providerLearned    = models.ProviderLearned
+	providerDictionary = models.ProviderDictionary
+	providerWeb        = models.ProviderWeb
 )
 
 func main() {
@@ -62,13 +79,51 @@ func main() {
 		logger.Fatal().Err(err).Msg("failed to connect to db")
 	}
 
-	// Для обогащения сообщений
-	userAPI := api.New(logger)
+	// Транслитерация имен перед запросом к api
+	scheme, err := translit.ParseScheme(cfg.API.Translit)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to parse transliteration scheme")
+	}
 
 	// Хранилище
 	strg := storage.New(conn)
+	// Для обогащения сообщений
+	userAPI, err := newUserAPI(cfg, strg)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to create enrichment providers")
+	}
+
 	// Сервис
-	svc := service.New(logger, userAPI, strg)
+	svc := service.New(logger, userAPI, strg, service.Config{
+		EnrichTimeout: cfg.API.EnrichTimeout,
+		StoredTTL:     cfg.API.StoredTTL,
+		TaskLease:     cfg.Worker.TaskLease,
+		MaxAttempts:   cfg.Worker.MaxAttempts,
+		RetryDelay:    cfg.Worker.RetryDelay,
+		RetryMaxDelay: cfg.Worker.RetryMaxDelay,
+
+		ReviewThreshold: cfg.Review.Threshold,
+		Translit:        scheme,
+		Localize:        cfg.API.Localize,
+		DefaultCountry:  strings.ToUpper(cfg.API.DefaultCountry),
+		PageSize:        cfg.List.PageSize,
+		MaxPageSize:     cfg.List.MaxPageSize,
+	})
+
+	// Консольная команда вместо запуска сервера
+	if len(os.Args) > 1 {
+		if err = runCommand(context.Background(), svc, os.Args[1:]); err != nil {
+			logger.Fatal().Err(err).Msg("command failed")
+		}
+		return
+	}
+
+	// Фоновое обогащение пользователей
+	pool := worker.New(logger, svc, worker.Config{
+		Workers:      cfg.Worker.Count,
+		BatchSize:    cfg.Worker.BatchSize,
+		PollInterval: cfg.Worker.PollInterval,
+	})
 	// Хэндлер
 	handler := handlers.New(logger, svc)
 	// Сервер
@@ -78,6 +133,14 @@ func main() {
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, syscall.SIGINT)
 
+	// Запускаем обработчики очереди
+	ctx, cancel := context.WithCancel(context.Background())
+	workersDone := make(chan struct{})
+	go func() {
+		pool.Run(ctx)
+		close(workersDone)
+	}()
+
 	// Запусвкаем сервер
 	go func() {
 		fmt.Println("Сервер запущен")
@@ -88,4 +151,95 @@ func main() {
 
 	// Ждем нажатия Ctrl+C
 	<-shutdown
+
+	// Обработчики перестают захватывать пользователей и дообрабатывают уже захваченных
+	cancel()
+	<-workersDone
+}
+
+// Источники данных для обогащения в порядке приоритета из настроек
+func newUserAPI(cfg *config.Config, strg storage.Storage) (api.UserAPI, error) {
+	logger := cfg.Logger()
+
+	providers := make([]api.NamedProvider, 0, len(cfg.API.Providers))
+	for _, name := range cfg.API.Providers {
+		switch name = strings.TrimSpace(name); name {
+		case providerLearned:
+			providers = append(providers, api.NamedProvider{Name: name, Provider: learned.New(strg, cfg.API.LearnedMinVotes)})
+		case providerDictionary:
+			// Словарь не задан - пропускаем
+			if cfg.API.DictionaryPath == "" {
+				continue
+			}
+			dict, err := dictionary.Load(cfg.API.DictionaryPath)
+			if err != nil {
+				return nil, err
+			}
+			providers = append(providers, api.NamedProvider{Name: name, Provider: dict})
+		case providerWeb:
+			var web api.UserAPI = api.New(logger, &http.Client{}, api.Config{
+				AgeURL:    cfg.API.AgeURL,
+				GenderURL: cfg.API.GenderURL,
+				NationURL: cfg.API.NationURL,
+				Key:       cfg.API.Key,
+				Timeout:   cfg.API.Timeout,
+
+				Retries:          cfg.API.Retries,
+				RetryBaseDelay:   cfg.API.RetryBaseDelay,
+				RetryMaxDelay:    cfg.API.RetryMaxDelay,
+				BreakerThreshold: cfg.API.BreakerThreshold,
+				BreakerCooldown:  cfg.API.BreakerCooldown,
+				RateLimit:        cfg.API.RateLimit,
+				RateBurst:        cfg.API.RateBurst,
+			})
+			if cfg.API.CacheSize > 0 {
+				web = api.NewCached(web, cfg.API.CacheSize, cfg.API.CacheTTL, cfg.API.EnrichTimeout)
+			}
+			providers = append(providers, api.NamedProvider{Name: name, Provider: web})
+		default:
+			return nil, fmt.Errorf("unknown enrichment provider %q, available: %s, %s, %s",
+				name, providerLearned, providerDictionary, providerWeb)
+		}
+	}
+
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("no enrichment providers configured")
+	}
+
+	return api.NewRegistry(logger, providers...), nil
+}
+
+// Выполняем консольную команду вместо запуска сервера
+func runCommand(ctx context.Context, svc service.Service, args []string) error {
+	switch args[0] {
+	case commandReenrich:
+		return reenrich(ctx, svc, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q, available: %s", args[0], commandReenrich)
+	}
+}
+
+// Повторное обогащение пользователей, например:
+// go run cmd/main.go reenrich -status failed -dry-run
+func reenrich(ctx context.Context, svc service.Service, args []string) error {
+	var opts models.ReenrichOptions
+
+	flags := flag.NewFlagSet(commandReenrich, flag.ContinueOnError)
+	flags.IntVar(&opts.ID, "id", 0, "reenrich only the user with this ID")
+	flags.StringVar(&opts.Status, "status", "", "reenrich only users with this enrichment status (pending, enriched, failed)")
+	flags.BoolVar(&opts.Incomplete, "incomplete", false, "reenrich only users with empty age, gender or nation")
+	flags.BoolVar(&opts.All, "all", false, "reenrich all users")
+	flags.BoolVar(&opts.DryRun, "dry-run", false, "only print changes without saving them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	result, err := svc.ReenrichUsers(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
 }
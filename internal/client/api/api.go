@@ -1,87 +1,213 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
+	"net/url"
+	"time"
 
+	"github.com/Yury132/Golang-Task-4/internal/models"
 	"github.com/rs/zerolog"
 )
 
 type UserAPI interface {
-	// Получаем данные о возрасте
-	GetAge(name string) ([]byte, error)
-	// Получаем данные о возрасте
-	GetGender(name string) ([]byte, error)
-	// Получаем данные о национальности
-	GetNation(name string) ([]byte, error)
+	// Получаем данные о возрасте сразу для нескольких имен (не более MaxBatchSize),
+	// country - код страны для уточнения прогноза, пусто - без уточнения
+	GetAges(ctx context.Context, names []string, country string) ([]models.AgeResult, error)
+	// Получаем данные о поле сразу для нескольких имен (не более MaxBatchSize),
+	// country - код страны для уточнения прогноза, пусто - без уточнения
+	GetGenders(ctx context.Context, names []string, country string) ([]models.GenderResult, error)
+	// Получаем данные о национальности сразу для нескольких имен (не более MaxBatchSize)
+	GetNations(ctx context.Context, names []string) ([]models.NationResult, error)
+	// Текущее состояние клиента
+	Status() models.APIStatus
+	// Сбрасываем закэшированные результаты для имени
+	Forget(name string)
+}
+
+// Поля, которые запрашиваются у api
+const (
+	fieldAge    = "age"
+	fieldGender = "gender"
+	fieldNation = "nation"
+)
+
+// Настройки подключения к внешним api
+type Config struct {
+	// Базовые адреса сервисов, например, https://api.agify.io
+	AgeURL    string
+	GenderURL string
+	NationURL string
+	// Ключ для платных тарифов, передается параметром apikey, если задан
+	Key string
+	// Ограничение времени на каждый запрос к внешнему api
+	Timeout time.Duration
+	// Количество повторов при недоступности api
+	Retries int
+	// Начальная и максимальная пауза между повторами, пауза растет вдвое с каждой попыткой
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// Сколько неудачных запросов подряд отключают api, 0 - предохранитель выключен
+	BreakerThreshold int
+	// Через сколько после отключения api проверяется пробным запросом
+	BreakerCooldown time.Duration
+	// Не более RateLimit запросов в секунду к каждому api, но до RateBurst подряд, 0 - без ограничения
+	RateLimit float64
+	RateBurst int
+}
+
+// Внешний сервис, его предохранитель и ограничения запросов
+type provider struct {
+	name    string
+	url     string
+	breaker *breaker
+	quota   *quota
+	bucket  *tokenBucket
 }
 
 type api struct {
 	logger zerolog.Logger
+	client *http.Client
+	cfg    Config
+	age    *provider
+	gender *provider
+	nation *provider
 }
 
-// Получаем данные о возрасте
-func (a *api) GetAge(name string) ([]byte, error) {
-
-	// Обращаемся по адресу
-	const url = "https://api.agify.io/?name="
-	response, err := http.Get(url + name)
+// Текущее состояние клиента
+func (a *api) Status() models.APIStatus {
+	return models.APIStatus{
+		Providers: []models.ProviderStatus{
+			a.age.status(),
+			a.gender.status(),
+			a.nation.status(),
+		},
+	}
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed getting user age from api: %s", err.Error())
+// Состояние предохранителя и квоты
+func (p *provider) status() models.ProviderStatus {
+	status := p.breaker.status()
+	if limit, remaining, resetAt, ok := p.quota.status(); ok {
+		status.Quota = &models.QuotaStatus{
+			Limit:     limit,
+			Remaining: remaining,
+			ResetAt:   resetAt,
+		}
 	}
+	return status
+}
 
-	defer func() {
-		if err = response.Body.Close(); err != nil {
-			a.logger.Error().Err(err).Msg("failed to close body")
+// Клиент ничего не кэширует
+func (a *api) Forget(name string) {}
+
+// Выполняем GET запрос, повторяя его при недоступности api.
+// Для нескольких имен используется параметр name[], тогда api возвращает массив.
+// Непустой country передается параметром country_id для уточнения прогноза
+func (a *api) get(ctx context.Context, p *provider, country string, names ...string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		// Квота исчерпана - не тратим запрос, ждать придется до ее сброса
+		if err := p.quota.check(p.name, uniqueNames(names)); err != nil {
+			return nil, err
+		}
+		if err := p.bucket.wait(ctx); err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrUnavailable, p.name, err)
+		}
+		if err := p.breaker.allow(); err != nil {
+			return nil, err
 		}
-	}()
 
-	// Возвращаем массив байтов
-	contents, err := io.ReadAll(response.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed reading response body: %s", err.Error())
-	}
+		contents, err := a.do(ctx, p, country, names...)
+		if err != nil && ctx.Err() != nil {
+			// Запрос отменен вызывающим - api тут ни при чем
+			p.breaker.cancel()
+			return nil, err
+		}
+		p.breaker.record(err)
+		if err == nil {
+			return contents, nil
+		}
 
-	return contents, nil
+		// Повторяем только если api недоступен - остальные ошибки повтором не исправить
+		if attempt >= a.cfg.Retries || !errors.Is(err, ErrUnavailable) {
+			return nil, err
+		}
+
+		delay := a.backoff(attempt)
+		a.logger.Debug().Err(err).Str("provider", p.name).Int("attempt", attempt+1).Dur("delay", delay).Msg("retrying api request")
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+	}
 }
 
-// Получаем данные о поле
-func (a *api) GetGender(name string) ([]byte, error) {
+// Пауза перед повтором: экспоненциальный рост со случайным разбросом,
+// чтобы повторы разных запросов не приходили одновременно
+func (a *api) backoff(attempt int) time.Duration {
+	delay := a.cfg.RetryBaseDelay << attempt
+	if delay <= 0 || (a.cfg.RetryMaxDelay > 0 && delay > a.cfg.RetryMaxDelay) {
+		delay = a.cfg.RetryMaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
 
-	// Обращаемся по адресу
-	const url = "https://api.genderize.io/?name="
-	response, err := http.Get(url + name)
+// Выполняем один GET запрос с ограничением по времени и проверкой кода ответа
+func (a *api) do(ctx context.Context, p *provider, country string, names ...string) ([]byte, error) {
+	if a.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.cfg.Timeout)
+		defer cancel()
+	}
 
+	// Формируем адрес с экранированными параметрами
+	u, err := url.Parse(p.url)
 	if err != nil {
-		return nil, fmt.Errorf("failed getting user gender from api: %s", err.Error())
+		return nil, fmt.Errorf("failed parsing api url: %w", err)
 	}
-
-	defer func() {
-		if err = response.Body.Close(); err != nil {
-			a.logger.Error().Err(err).Msg("failed to close body")
+	query := u.Query()
+	if len(names) == 1 {
+		query.Set("name", names[0])
+	} else {
+		for _, name := range names {
+			query.Add("name[]", name)
 		}
-	}()
+	}
+	if country != "" {
+		query.Set("country_id", country)
+	}
+	if a.cfg.Key != "" {
+		query.Set("apikey", a.cfg.Key)
+	}
+	u.RawQuery = query.Encode()
 
-	// Возвращаем массив байтов
-	contents, err := io.ReadAll(response.Body)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed reading response body: %s", err.Error())
+		return nil, fmt.Errorf("failed creating request: %w", err)
 	}
 
-	return contents, nil
-}
-
-// Получаем данные о национальности
-func (a *api) GetNation(name string) ([]byte, error) {
-
 	// Обращаемся по адресу
-	const url = "https://api.nationalize.io/?name="
-	response, err := http.Get(url + name)
-
+	response, err := a.client.Do(request)
 	if err != nil {
-		return nil, fmt.Errorf("failed getting user nation from api: %s", err.Error())
+		// Текст url.Error содержит полный адрес вместе с ключом - убираем его
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		// Таймаут или сетевая ошибка - считаем, что api недоступен
+		return nil, fmt.Errorf("%w: %s: %w", ErrUnavailable, p.url, err)
 	}
 
 	defer func() {
@@ -90,17 +216,54 @@ func (a *api) GetNation(name string) ([]byte, error) {
 		}
 	}()
 
+	p.quota.update(response.Header, response.StatusCode)
+
 	// Возвращаем массив байтов
 	contents, err := io.ReadAll(response.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed reading response body: %s", err.Error())
+		return nil, fmt.Errorf("%w: failed reading response body: %w", ErrUnavailable, err)
+	}
+
+	if response.StatusCode == http.StatusTooManyRequests {
+		return nil, fmt.Errorf("%w: %w", p.quota.error(p.name), statusError(p.url, response.StatusCode, a.redact(contents)))
+	}
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		// Ключ не должен попасть в логи
+		return nil, statusError(p.url, response.StatusCode, a.redact(contents))
 	}
 
 	return contents, nil
 }
 
-func New(logger zerolog.Logger) UserAPI {
+// Api может повторить ключ в тексте ошибки - убираем его из тела ответа
+func (a *api) redact(body []byte) []byte {
+	if a.cfg.Key == "" {
+		return body
+	}
+	return bytes.ReplaceAll(body, []byte(a.cfg.Key), []byte("***"))
+}
+
+func New(logger zerolog.Logger, client *http.Client, cfg Config) UserAPI {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	newProvider := func(name string, url string) *provider {
+		return &provider{
+			name:    name,
+			url:     url,
+			breaker: newBreaker(logger, name, cfg.BreakerThreshold, cfg.BreakerCooldown),
+			quota:   &quota{},
+			bucket:  newTokenBucket(cfg.RateLimit, cfg.RateBurst),
+		}
+	}
+
 	return &api{
 		logger: logger,
+		client: client,
+		cfg:    cfg,
+		age:    newProvider(fieldAge, cfg.AgeURL),
+		gender: newProvider(fieldGender, cfg.GenderURL),
+		nation: newProvider(fieldNation, cfg.NationURL),
 	}
 }
@@ -0,0 +1,340 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+const testKey = "secret-key"
+
+// Заглушка agify, genderize и nationalize: отвечает заданным кодом, заголовками и телом
+// и запоминает параметры запросов
+type stubServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	queries []url.Values
+	status  int
+	header  http.Header
+	body    string
+}
+
+func newStubServer(t *testing.T, status int, body string) *stubServer {
+	s := &stubServer{status: status, body: body, header: http.Header{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.queries = append(s.queries, r.URL.Query())
+		for key, values := range s.header {
+			w.Header()[key] = values
+		}
+		status, body := s.status, s.body
+		s.mu.Unlock()
+
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newTestAPI(s *stubServer) UserAPI {
+	return New(zerolog.Nop(), s.Client(), Config{
+		AgeURL:    s.URL + "/age",
+		GenderURL: s.URL + "/gender",
+		NationURL: s.URL + "/nation",
+		Key:       testKey,
+	})
+}
+
+func TestAPIStatusErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr error
+	}{
+		{name: "ok", status: http.StatusOK, body: `[{"name":"ivan","age":30,"count":5},{"name":"ivan","age":30,"count":5}]`},
+		{name: "bad request", status: http.StatusBadRequest, body: `{"error":"invalid name"}`, wantErr: ErrBadRequest},
+		{name: "unauthorized", status: http.StatusUnauthorized, body: `{"error":"invalid key secret-key"}`, wantErr: ErrBadRequest},
+		{name: "not found", status: http.StatusNotFound, wantErr: ErrBadRequest},
+		{name: "server error", status: http.StatusInternalServerError, wantErr: ErrUnavailable},
+		{name: "bad gateway", status: http.StatusBadGateway, wantErr: ErrUnavailable},
+		{name: "too many requests", status: http.StatusTooManyRequests, body: `{"error":"limit reached"}`, wantErr: ErrQuotaExhausted},
+		{name: "invalid json", status: http.StatusOK, body: `{"name":`, wantErr: ErrInvalidResponse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStubServer(t, tt.status, tt.body)
+
+			_, err := newTestAPI(s).GetAges(context.Background(), []string{"ivan"}, "")
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("GetAges() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetAges() error = %v, want %v", err, tt.wantErr)
+			}
+			if strings.Contains(err.Error(), testKey) {
+				t.Errorf("error %q contains api key", err)
+			}
+		})
+	}
+}
+
+func TestAPITooManyRequestsIsQuotaError(t *testing.T) {
+	s := newStubServer(t, http.StatusTooManyRequests, "")
+	s.header.Set(headerReset, "60")
+
+	client := newTestAPI(s)
+	_, err := client.GetGenders(context.Background(), []string{"ivan", "petr"}, "")
+	var quotaErr *QuotaError
+	if !errors.As(err, &quotaErr) || !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("GetGenders() error = %v, want QuotaError", err)
+	}
+
+	// Квота исчерпана до сброса - следующий запрос к api не отправляется
+	_, err = client.GetGenders(context.Background(), []string{"oleg"}, "")
+	if !errors.As(err, &quotaErr) {
+		t.Errorf("GetGenders() error = %v, want QuotaError", err)
+	}
+	if len(s.queries) != 1 {
+		t.Errorf("sent %d requests, want 1", len(s.queries))
+	}
+}
+
+func TestAPINetworkErrorHidesKey(t *testing.T) {
+	s := newStubServer(t, http.StatusOK, "")
+	client := newTestAPI(s)
+	s.Close()
+
+	_, err := client.GetNations(context.Background(), []string{"ivan", "petr"})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("GetNations() error = %v, want %v", err, ErrUnavailable)
+	}
+	if strings.Contains(err.Error(), testKey) {
+		t.Errorf("error %q contains api key", err)
+	}
+}
+
+func TestAPIQuery(t *testing.T) {
+	tests := []struct {
+		name        string
+		names       []string
+		country     string
+		wantNames   []string
+		wantCountry string
+	}{
+		{
+			name:      "batch",
+			names:     []string{"Иван", "Anna Maria", "o'neil"},
+			wantNames: []string{"Иван", "Anna Maria", "o'neil"},
+		},
+		{
+			name:      "single name is duplicated",
+			names:     []string{"Иван"},
+			wantNames: []string{"Иван", "Иван"},
+		},
+		{
+			name:        "country",
+			names:       []string{"ivan", "petr"},
+			country:     "RU",
+			wantNames:   []string{"ivan", "petr"},
+			wantCountry: "RU",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := "["
+			for i := range tt.wantNames {
+				if i > 0 {
+					body += ","
+				}
+				body += `{"name":"x","gender":"male","probability":0.9,"count":10}`
+			}
+			s := newStubServer(t, http.StatusOK, body+"]")
+
+			results, err := newTestAPI(s).GetGenders(context.Background(), tt.names, tt.country)
+			if err != nil {
+				t.Fatalf("GetGenders() error = %v", err)
+			}
+			if len(results) != len(tt.names) {
+				t.Errorf("got %d results for %d names", len(results), len(tt.names))
+			}
+			for _, result := range results {
+				if result.Country != tt.country {
+					t.Errorf("result country = %q, want %q", result.Country, tt.country)
+				}
+			}
+
+			query := s.queries[0]
+			if got := query["name[]"]; strings.Join(got, "|") != strings.Join(tt.wantNames, "|") {
+				t.Errorf("name[] = %q, want %q", got, tt.wantNames)
+			}
+			if query.Has("name") {
+				t.Errorf("unexpected name parameter %q", query.Get("name"))
+			}
+			if got := query.Get("country_id"); got != tt.wantCountry || query.Has("country_id") != (tt.wantCountry != "") {
+				t.Errorf("country_id = %q, want %q", got, tt.wantCountry)
+			}
+			if got := query.Get("apikey"); got != testKey {
+				t.Errorf("apikey = %q, want %q", got, testKey)
+			}
+		})
+	}
+}
+
+func TestAPIDecodeAges(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantAge   []int
+		wantFound []bool
+		wantErr   bool
+	}{
+		{name: "ages", body: `[{"name":"a","age":30,"count":5},{"name":"b","age":0,"count":1}]`, wantAge: []int{30, 0}, wantFound: []bool{true, true}},
+		{name: "null age", body: `[{"name":"a","age":null,"count":0},{"name":"b","age":41,"count":3}]`, wantAge: []int{0, 41}, wantFound: []bool{false, true}},
+		{name: "negative age", body: `[{"name":"a","age":-1},{"name":"b","age":41}]`, wantErr: true},
+		{name: "age is string", body: `[{"name":"a","age":"30"},{"name":"b","age":41}]`, wantErr: true},
+		{name: "wrong result count", body: `[{"name":"a","age":30}]`, wantErr: true},
+		{name: "object instead of array", body: `{"name":"a","age":30}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStubServer(t, http.StatusOK, tt.body)
+
+			results, err := newTestAPI(s).GetAges(context.Background(), []string{"a", "b"}, "")
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidResponse) {
+					t.Errorf("GetAges() error = %v, want %v", err, ErrInvalidResponse)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetAges() error = %v", err)
+			}
+			for i, result := range results {
+				if result.Age != tt.wantAge[i] || result.Found != tt.wantFound[i] {
+					t.Errorf("result %d = %+v, want age %d found %v", i, result, tt.wantAge[i], tt.wantFound[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAPIDecodeGenders(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantGender string
+		wantFound  bool
+		wantErr    bool
+	}{
+		{name: "gender", body: `{"name":"a","gender":"female","probability":0.98,"count":10}`, wantGender: "female", wantFound: true},
+		{name: "upper case", body: `{"name":"a","gender":"MALE","probability":0.6,"count":10}`, wantGender: "male", wantFound: true},
+		{name: "null gender", body: `{"name":"a","gender":null,"probability":0,"count":0}`},
+		{name: "unknown gender", body: `{"name":"a","gender":"other","probability":0.5}`, wantErr: true},
+		{name: "probability above one", body: `{"name":"a","gender":"male","probability":1.5}`, wantErr: true},
+		{name: "negative probability", body: `{"name":"a","gender":"male","probability":-0.1}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStubServer(t, http.StatusOK, "["+tt.body+","+tt.body+"]")
+
+			results, err := newTestAPI(s).GetGenders(context.Background(), []string{"a"}, "")
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidResponse) {
+					t.Errorf("GetGenders() error = %v, want %v", err, ErrInvalidResponse)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetGenders() error = %v", err)
+			}
+			if len(results) != 1 || results[0].Gender != tt.wantGender || results[0].Found != tt.wantFound {
+				t.Errorf("GetGenders() = %+v, want gender %q found %v", results, tt.wantGender, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestAPIDecodeNations(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantTop   string
+		wantFound bool
+		wantErr   bool
+	}{
+		{name: "sorted by probability", body: `{"name":"a","country":[{"country_id":"ua","probability":0.2},{"country_id":"RU","probability":0.7}]}`, wantTop: "RU", wantFound: true},
+		{name: "lower case code", body: `{"name":"a","country":[{"country_id":"kz","probability":0.4}]}`, wantTop: "KZ", wantFound: true},
+		{name: "empty countries", body: `{"name":"a","country":[]}`},
+		{name: "null countries", body: `{"name":"a","country":null}`},
+		{name: "three letter code", body: `{"name":"a","country":[{"country_id":"RUS","probability":0.4}]}`, wantErr: true},
+		{name: "probability out of range", body: `{"name":"a","country":[{"country_id":"RU","probability":2}]}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStubServer(t, http.StatusOK, "["+tt.body+","+tt.body+"]")
+
+			results, err := newTestAPI(s).GetNations(context.Background(), []string{"a"})
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidResponse) {
+					t.Errorf("GetNations() error = %v, want %v", err, ErrInvalidResponse)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetNations() error = %v", err)
+			}
+			top, _ := results[0].Top()
+			if results[0].Found != tt.wantFound || top.Country_id != tt.wantTop {
+				t.Errorf("GetNations() = %+v, want top %q found %v", results[0], tt.wantTop, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestAPIBatchWithinQuota(t *testing.T) {
+	s := newStubServer(t, http.StatusOK, `[{"name":"a","age":30},{"name":"b","age":40}]`)
+	s.header.Set(headerRemaining, "2")
+	s.header.Set(headerReset, "60")
+	client := newTestAPI(s)
+
+	// Первый запрос сообщает, что осталось 2 имени
+	if _, err := client.GetAges(context.Background(), []string{"a", "b"}, ""); err != nil {
+		t.Fatalf("GetAges() error = %v", err)
+	}
+
+	results, err := client.GetAges(context.Background(), []string{"a", "b", "c"}, "")
+	var partial *PartialError
+	if !errors.As(err, &partial) || !errors.Is(err, ErrQuotaExhausted) {
+		t.Fatalf("GetAges() error = %v, want partial quota error", err)
+	}
+	wantResolved := []bool{true, true, false}
+	for i, resolved := range partial.Resolved {
+		if resolved != wantResolved[i] {
+			t.Errorf("resolved = %v, want %v", partial.Resolved, wantResolved)
+			break
+		}
+	}
+	if results[0].Age != 30 || results[1].Age != 40 || results[2].Found {
+		t.Errorf("GetAges() = %+v", results)
+	}
+	if got := s.queries[1]["name[]"]; strings.Join(got, "|") != "a|b" {
+		t.Errorf("name[] = %q, want only names within quota", got)
+	}
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+)
+
+// Максимальное количество имен в одном запросе к agify, genderize и nationalize
+const MaxBatchSize = 10
+
+// Получаем данные о возрасте сразу для нескольких имен
+func (a *api) GetAges(ctx context.Context, names []string, country string) ([]models.AgeResult, error) {
+	results, err := fetchBatch(ctx, a, a.age, fieldAge, country, names, decodeAges)
+	for i := range results {
+		results[i].Country = country
+	}
+	return results, err
+}
+
+// Получаем данные о поле сразу для нескольких имен
+func (a *api) GetGenders(ctx context.Context, names []string, country string) ([]models.GenderResult, error) {
+	results, err := fetchBatch(ctx, a, a.gender, fieldGender, country, names, decodeGenders)
+	for i := range results {
+		results[i].Country = country
+	}
+	return results, err
+}
+
+// Получаем данные о национальности сразу для нескольких имен
+func (a *api) GetNations(ctx context.Context, names []string) ([]models.NationResult, error) {
+	return fetchBatch(ctx, a, a.nation, fieldNation, "", names, decodeNations)
+}
+
+// Запрашиваем и разбираем пакет имен. Если квоты хватает не на все имена, запрашиваем те,
+// на которые хватает, а для остальных возвращаем PartialError с ошибкой квоты
+func fetchBatch[T any](ctx context.Context, a *api, p *provider, field string, country string, names []string,
+	decode func([]byte, []string) ([]T, error)) ([]T, error) {
+	if err := checkBatch(names); err != nil {
+		return nil, err
+	}
+
+	sent, quotaErr := p.quota.fit(p.name, names)
+	if len(sent) == 0 {
+		return nil, quotaErr
+	}
+
+	query := batchNames(sent)
+	contents, err := a.get(ctx, p, country, query...)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting users %s from api: %w", field, err)
+	}
+
+	decoded, err := decode(contents, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed decoding users %s from api: %w", field, err)
+	}
+	if quotaErr == nil {
+		return decoded[:len(names)], nil
+	}
+
+	// Имя могло встретиться и после отправленной части - берем результат по имени
+	byName := make(map[string]T, len(sent))
+	for j, name := range sent {
+		byName[name] = decoded[j]
+	}
+	results := make([]T, len(names))
+	resolved := make([]bool, len(names))
+	for i, name := range names {
+		results[i], resolved[i] = byName[name]
+	}
+
+	return results, &PartialError{Err: quotaErr, Resolved: resolved}
+}
+
+func checkBatch(names []string) error {
+	if len(names) == 0 || len(names) > MaxBatchSize {
+		return fmt.Errorf("%w: batch must contain from 1 to %d names, got %d", ErrBadRequest, MaxBatchSize, len(names))
+	}
+	return nil
+}
+
+// Для одного имени get использует параметр name и api вернет объект, а не массив -
+// дублируем имя, чтобы ответ всегда был массивом. Квоту повтор не расходует - см. uniqueNames
+func batchNames(names []string) []string {
+	if len(names) == 1 {
+		return []string{names[0], names[0]}
+	}
+	return names
+}
+
+// Количество разных имен - только они расходуют квоту
+func uniqueNames(names []string) int {
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		seen[name] = true
+	}
+	return len(seen)
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+	"github.com/rs/zerolog"
+)
+
+// Api признан недоступным, запросы не отправляются до истечения паузы
+var ErrCircuitOpen = errors.New("api circuit breaker is open")
+
+// Состояния предохранителя
+const (
+	// Запросы проходят
+	breakerClosed = "closed"
+	// Запросы отклоняются сразу
+	breakerOpen = "open"
+	// Пропускается один пробный запрос
+	breakerHalfOpen = "half-open"
+)
+
+// Предохранитель: после threshold неудачных запросов подряд api считается недоступным
+// на время cooldown, затем пробным запросом проверяем, восстановился ли он
+type breaker struct {
+	mu        sync.Mutex
+	logger    zerolog.Logger
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	state    string
+	failures int
+	openedAt time.Time
+	// Пробный запрос уже отправлен
+	probing bool
+}
+
+func newBreaker(logger zerolog.Logger, name string, threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		logger:    logger,
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     breakerClosed,
+	}
+}
+
+// Можно ли отправить запрос
+func (b *breaker) allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return fmt.Errorf("%w: %s: %w", ErrUnavailable, b.name, ErrCircuitOpen)
+		}
+		b.setState(breakerHalfOpen)
+		b.probing = true
+		return nil
+	case breakerHalfOpen:
+		if b.probing {
+			return fmt.Errorf("%w: %s: %w", ErrUnavailable, b.name, ErrCircuitOpen)
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Учитываем результат запроса: недоступность api - неудача, остальное - успех
+func (b *breaker) record(err error) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+
+	if err == nil || !errors.Is(err, ErrUnavailable) {
+		b.failures = 0
+		if b.state != breakerClosed {
+			b.setState(breakerClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		b.setState(breakerOpen)
+	}
+}
+
+// Пробный запрос не состоялся (например, отменен вызывающим) - разрешаем следующий
+func (b *breaker) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+func (b *breaker) setState(state string) {
+	b.state = state
+
+	event := b.logger.Info()
+	if state == breakerOpen {
+		event = b.logger.Warn().Int("failures", b.failures).Dur("cooldown", b.cooldown)
+	}
+	event.Str("provider", b.name).Str("state", state).Msg("api circuit breaker state changed")
+}
+
+// Текущее состояние для отображения
+func (b *breaker) status() models.ProviderStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := models.ProviderStatus{
+		Name:     b.name,
+		State:    b.state,
+		Failures: b.failures,
+	}
+	if b.state == breakerOpen {
+		retryAt := b.openedAt.Add(b.cooldown)
+		status.RetryAt = &retryAt
+	}
+
+	return status
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestBreaker(t *testing.T) {
+	unavailable := errors.Join(ErrUnavailable, errors.New("connection refused"))
+
+	tests := []struct {
+		name      string
+		threshold int
+		cooldown  time.Duration
+		results   []error
+		wait      time.Duration
+		wantState string
+		wantAllow bool
+	}{
+		{
+			name:      "disabled breaker always allows",
+			threshold: 0,
+			results:   []error{unavailable, unavailable, unavailable},
+			wantState: breakerClosed,
+			wantAllow: true,
+		},
+		{
+			name:      "stays closed below threshold",
+			threshold: 3,
+			cooldown:  time.Hour,
+			results:   []error{unavailable, unavailable},
+			wantState: breakerClosed,
+			wantAllow: true,
+		},
+		{
+			name:      "opens at threshold",
+			threshold: 3,
+			cooldown:  time.Hour,
+			results:   []error{unavailable, unavailable, unavailable},
+			wantState: breakerOpen,
+			wantAllow: false,
+		},
+		{
+			name:      "success resets failures",
+			threshold: 2,
+			cooldown:  time.Hour,
+			results:   []error{unavailable, nil, unavailable},
+			wantState: breakerClosed,
+			wantAllow: true,
+		},
+		{
+			name:      "other errors count as success",
+			threshold: 2,
+			cooldown:  time.Hour,
+			results:   []error{unavailable, ErrBadRequest, unavailable},
+			wantState: breakerClosed,
+			wantAllow: true,
+		},
+		{
+			name:      "allows probe after cooldown",
+			threshold: 1,
+			cooldown:  time.Millisecond,
+			results:   []error{unavailable},
+			wait:      5 * time.Millisecond,
+			wantState: breakerHalfOpen,
+			wantAllow: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBreaker(zerolog.Nop(), "test", tt.threshold, tt.cooldown)
+			for _, err := range tt.results {
+				b.record(err)
+			}
+			time.Sleep(tt.wait)
+
+			if err := b.allow(); (err == nil) != tt.wantAllow {
+				t.Errorf("allow() = %v, want allowed %v", err, tt.wantAllow)
+			} else if err != nil && !errors.Is(err, ErrCircuitOpen) {
+				t.Errorf("allow() = %v, want %v", err, ErrCircuitOpen)
+			}
+			if tt.threshold > 0 && b.state != tt.wantState {
+				t.Errorf("state = %s, want %s", b.state, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestBreakerProbe(t *testing.T) {
+	unavailable := errors.Join(ErrUnavailable, errors.New("timeout"))
+
+	tests := []struct {
+		name      string
+		probe     error
+		wantState string
+	}{
+		{name: "successful probe closes", probe: nil, wantState: breakerClosed},
+		{name: "failed probe opens again", probe: unavailable, wantState: breakerOpen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBreaker(zerolog.Nop(), "test", 1, time.Millisecond)
+			b.record(unavailable)
+			time.Sleep(5 * time.Millisecond)
+
+			if err := b.allow(); err != nil {
+				t.Fatalf("probe not allowed: %v", err)
+			}
+			// Пока идет пробный запрос, остальные отклоняются
+			if err := b.allow(); err == nil {
+				t.Fatalf("second request allowed during probe")
+			}
+
+			b.record(tt.probe)
+			if b.state != tt.wantState {
+				t.Errorf("state = %s, want %s", b.state, tt.wantState)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+)
+
+// Разделитель имени и страны в ключе кэша
+const countrySeparator = "@"
+
+// Кэширующая обертка над UserAPI.
+// Одновременные запросы одного и того же имени объединяются в один запрос к api
+type cached struct {
+	next    UserAPI
+	size    int
+	timeout time.Duration
+	ages    *lru[models.AgeResult]
+	genders *lru[models.GenderResult]
+	nations *lru[models.NationResult]
+	hits    atomic.Uint64
+	misses  atomic.Uint64
+
+	mu sync.Mutex
+	// Имена, которые сейчас запрашиваются у api, ключ - поле и ключ кэша
+	flights map[string]*flight
+}
+
+// Запрос имени к api, результат которого ждут все, кому нужно это имя
+type flight struct {
+	done  chan struct{}
+	value any
+	err   error
+}
+
+// Получаем данные о возрасте сразу для нескольких имен
+func (c *cached) GetAges(ctx context.Context, names []string, country string) ([]models.AgeResult, error) {
+	return lookupBatch(ctx, c, c.ages, fieldAge, names, country, c.next.GetAges)
+}
+
+// Получаем данные о поле сразу для нескольких имен
+func (c *cached) GetGenders(ctx context.Context, names []string, country string) ([]models.GenderResult, error) {
+	return lookupBatch(ctx, c, c.genders, fieldGender, names, country, c.next.GetGenders)
+}
+
+// Получаем данные о национальности сразу для нескольких имен
+func (c *cached) GetNations(ctx context.Context, names []string) ([]models.NationResult, error) {
+	return lookupBatch(ctx, c, c.nations, fieldNation, names, "", func(ctx context.Context, names []string, _ string) ([]models.NationResult, error) {
+		return c.next.GetNations(ctx, names)
+	})
+}
+
+// Состояние api вместе со статистикой кэша
+func (c *cached) Status() models.APIStatus {
+	status := c.next.Status()
+	status.Cache = &models.CacheStats{
+		Hits:     c.hits.Load(),
+		Misses:   c.misses.Load(),
+		Size:     c.ages.len() + c.genders.len() + c.nations.len(),
+		Capacity: c.size * 3,
+	}
+	return status
+}
+
+// Сбрасываем закэшированные результаты для имени, в том числе уточненные по странам
+func (c *cached) Forget(name string) {
+	key := cacheKey(name)
+	c.ages.removeName(key)
+	c.genders.removeName(key)
+	c.nations.removeName(key)
+	c.next.Forget(name)
+}
+
+// Имена в api не зависят от регистра
+func cacheKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// Прогноз, уточненный по стране, кэшируется отдельно
+func localizedKey(name string, country string) string {
+	if country == "" {
+		return cacheKey(name)
+	}
+	return cacheKey(name) + countrySeparator + country
+}
+
+// Берем из кэша все, что есть. Недостающие имена, которые уже запрашивает другой вызывающий,
+// ждем, остальные запрашиваем у api одним пакетом
+func lookupBatch[T any](ctx context.Context, c *cached, cache *lru[T], field string, names []string, country string,
+	fetch func(context.Context, []string, string) ([]T, error)) ([]T, error) {
+	results := make([]T, len(names))
+
+	// Имя может встретиться несколько раз - запоминаем все позиции
+	missing := make([]string, 0, len(names))
+	positions := make(map[string][]int)
+	for i, name := range names {
+		key := localizedKey(name, country)
+		if value, ok := cache.get(key); ok {
+			c.hits.Add(1)
+			results[i] = value
+			continue
+		}
+		c.misses.Add(1)
+
+		if _, ok := positions[key]; !ok {
+			missing = append(missing, name)
+		}
+		positions[key] = append(positions[key], i)
+	}
+
+	if len(missing) == 0 {
+		return results, nil
+	}
+
+	flights, owned := c.join(field, missing, country)
+	if len(owned) > 0 {
+		go fly(ctx, c, cache, field, owned, country, flights, fetch)
+	}
+
+	// Имена, которые api не обработал, отмечаем - результаты для остальных действительны
+	resolved := make([]bool, len(names))
+	for i := range resolved {
+		resolved[i] = true
+	}
+	var lastErr error
+	for _, name := range missing {
+		key := localizedKey(name, country)
+		f := flights[key]
+		select {
+		case <-ctx.Done():
+			// Перестаем ждать, общий запрос при этом продолжается для остальных
+			return nil, ctx.Err()
+		case <-f.done:
+		}
+		for _, i := range positions[key] {
+			if f.err != nil {
+				resolved[i] = false
+			} else {
+				results[i] = f.value.(T)
+			}
+		}
+		if f.err != nil {
+			lastErr = f.err
+		}
+	}
+
+	if lastErr == nil {
+		return results, nil
+	}
+	for _, ok := range resolved {
+		if ok {
+			return results, &PartialError{Err: lastErr, Resolved: resolved}
+		}
+	}
+	return nil, lastErr
+}
+
+// Присоединяемся к уже выполняющимся запросам имен, для остальных имен создаем запросы.
+// Возвращает запросы по ключам кэша и имена, которые нужно запросить у api
+func (c *cached) join(field string, names []string, country string) (map[string]*flight, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	flights := make(map[string]*flight, len(names))
+	owned := make([]string, 0, len(names))
+	for _, name := range names {
+		key := localizedKey(name, country)
+		f, ok := c.flights[field+":"+key]
+		if !ok {
+			f = &flight{done: make(chan struct{})}
+			c.flights[field+":"+key] = f
+			owned = append(owned, name)
+		}
+		flights[key] = f
+	}
+
+	return flights, owned
+}
+
+// Запрашиваем имена у api и передаем результат всем ожидающим.
+// Запрос общий, поэтому не зависит от отмены контекста создавшего его вызывающего,
+// а ограничен собственным таймаутом. Ошибки не кэшируются - следующий запрос снова обратится к api
+func fly[T any](ctx context.Context, c *cached, cache *lru[T], field string, names []string, country string,
+	flights map[string]*flight, fetch func(context.Context, []string, string) ([]T, error)) {
+	flightCtx := context.WithoutCancel(ctx)
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		flightCtx, cancel = context.WithTimeout(flightCtx, c.timeout)
+		defer cancel()
+	}
+
+	fetched, err := fetch(flightCtx, names, country)
+	var partial *PartialError
+	if errors.As(err, &partial) {
+		err = partial.Err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for j, name := range names {
+		key := localizedKey(name, country)
+		f := flights[key]
+		if err != nil && (partial == nil || !partial.Resolved[j]) {
+			f.err = err
+		} else {
+			f.value = fetched[j]
+			cache.set(key, fetched[j])
+		}
+		delete(c.flights, field+":"+key)
+		close(f.done)
+	}
+}
+
+// Оборачиваем api кэшем на size записей для каждого поля, записи живут ttl.
+// Общий запрос одного имени ограничен timeout, 0 - без ограничения
+func NewCached(next UserAPI, size int, ttl time.Duration, timeout time.Duration) UserAPI {
+	return &cached{
+		next:    next,
+		size:    size,
+		timeout: timeout,
+		ages:    newLRU[models.AgeResult](size, ttl),
+		genders: newLRU[models.GenderResult](size, ttl),
+		nations: newLRU[models.NationResult](size, ttl),
+		flights: make(map[string]*flight),
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+)
+
+// Api, который считает запрошенные имена и отвечает, только когда его отпустят
+type countingAPI struct {
+	UserAPI
+	mu      sync.Mutex
+	calls   map[string]int
+	release chan struct{}
+}
+
+func (a *countingAPI) GetAges(ctx context.Context, names []string, country string) ([]models.AgeResult, error) {
+	a.mu.Lock()
+	for _, name := range names {
+		a.calls[name]++
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-a.release:
+	}
+
+	results := make([]models.AgeResult, 0, len(names))
+	for _, name := range names {
+		results = append(results, models.AgeResult{Name: name, Age: len(name), Found: true})
+	}
+	return results, nil
+}
+
+func (a *countingAPI) Forget(name string) {}
+
+func TestCachedBatchSharesUpstreamCalls(t *testing.T) {
+	tests := []struct {
+		name    string
+		batches [][]string
+		want    map[string]int
+	}{
+		{
+			name:    "same batch",
+			batches: [][]string{{"ivan", "petr"}, {"ivan", "petr"}},
+			want:    map[string]int{"ivan": 1, "petr": 1},
+		},
+		{
+			name:    "overlapping batches",
+			batches: [][]string{{"ivan", "petr"}, {"petr", "oleg"}, {"oleg", "ivan", "anna"}},
+			want:    map[string]int{"ivan": 1, "petr": 1, "oleg": 1, "anna": 1},
+		},
+		{
+			name:    "duplicate names in batch",
+			batches: [][]string{{"ivan", "IVAN", " ivan"}},
+			want:    map[string]int{"ivan": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := &countingAPI{calls: make(map[string]int), release: make(chan struct{})}
+			c := NewCached(upstream, 100, time.Hour, time.Second)
+
+			var wg sync.WaitGroup
+			errs := make(chan error, len(tt.batches))
+			for _, batch := range tt.batches {
+				wg.Add(1)
+				go func(batch []string) {
+					defer wg.Done()
+					results, err := c.GetAges(context.Background(), batch, "")
+					if err != nil {
+						errs <- err
+						return
+					}
+					for i, result := range results {
+						if result.Age != len(cacheKey(batch[i])) {
+							t.Errorf("result for %q = %+v", batch[i], result)
+						}
+					}
+				}(batch)
+				// Следующий пакет приходит, пока предыдущий еще запрашивается
+				time.Sleep(10 * time.Millisecond)
+			}
+			close(upstream.release)
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				t.Fatalf("GetAges() error = %v", err)
+			}
+			if len(upstream.calls) != len(tt.want) {
+				t.Errorf("requested names %v, want %v", upstream.calls, tt.want)
+			}
+			for name, want := range tt.want {
+				if upstream.calls[name] != want {
+					t.Errorf("%q requested %d times, want %d", name, upstream.calls[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestCachedBatchCallerCancel(t *testing.T) {
+	upstream := &countingAPI{calls: make(map[string]int), release: make(chan struct{})}
+	c := NewCached(upstream, 100, time.Hour, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := c.GetAges(ctx, []string{"ivan"}, "")
+		first <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	second := make(chan error, 1)
+	go func() {
+		_, err := c.GetAges(context.Background(), []string{"ivan"}, "")
+		second <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// Первый вызывающий ушел - общий запрос продолжается для второго
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Errorf("canceled caller error = %v, want %v", err, context.Canceled)
+	}
+	close(upstream.release)
+	if err := <-second; err != nil {
+		t.Errorf("second caller error = %v", err)
+	}
+	if upstream.calls["ivan"] != 1 {
+		t.Errorf("ivan requested %d times, want 1", upstream.calls["ivan"])
+	}
+}
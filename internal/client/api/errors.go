@@ -0,0 +1,64 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// Превышен лимит запросов к внешнему api (429)
+	ErrRateLimited = errors.New("api rate limit exceeded")
+	// Внешний api отклонил запрос как некорректный (4xx)
+	ErrBadRequest = errors.New("api rejected request")
+	// Внешний api недоступен (5xx, таймаут, сетевая ошибка)
+	ErrUnavailable = errors.New("api unavailable")
+	// Ответ внешнего api не удалось разобрать или он содержит некорректные данные
+	ErrInvalidResponse = errors.New("invalid api response")
+)
+
+// Ошибка ответа внешнего api с кодом, отличным от 2xx
+type StatusError struct {
+	// Адрес, по которому обращались
+	URL string
+	// Код ответа
+	StatusCode int
+	// Начало тела ответа - для логов
+	Body string
+	// Одна из ошибок ErrRateLimited, ErrBadRequest, ErrUnavailable
+	Err error
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: %s returned %d: %s", e.Err, e.URL, e.StatusCode, e.Body)
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// Определяем тип ошибки по коду ответа
+func statusError(url string, code int, body []byte) *StatusError {
+	var kind error
+	switch {
+	case code == http.StatusTooManyRequests:
+		kind = ErrRateLimited
+	case code >= http.StatusInternalServerError:
+		kind = ErrUnavailable
+	default:
+		kind = ErrBadRequest
+	}
+
+	// Тело ответа может быть большим - оставляем только начало
+	const maxBody = 256
+	if len(body) > maxBody {
+		body = body[:maxBody]
+	}
+
+	return &StatusError{
+		URL:        url,
+		StatusCode: code,
+		Body:       string(body),
+		Err:        kind,
+	}
+}
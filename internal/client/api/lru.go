@@ -0,0 +1,119 @@
+package api
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Кэш ограниченного размера: при переполнении вытесняется давно не использованная запись,
+// записи старше ttl считаются отсутствующими
+type lru[T any] struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	items map[string]*list.Element
+	order *list.List
+	// Ключи записей по имени: само имя и его варианты, уточненные по странам
+	names map[string]map[string]struct{}
+}
+
+type lruEntry[T any] struct {
+	key     string
+	value   T
+	expires time.Time
+}
+
+func newLRU[T any](size int, ttl time.Duration) *lru[T] {
+	return &lru[T]{
+		size:  size,
+		ttl:   ttl,
+		items: make(map[string]*list.Element, size),
+		order: list.New(),
+		names: make(map[string]map[string]struct{}),
+	}
+}
+
+// Имя, к которому относится ключ вида name или name + countrySeparator + country
+func keyName(key string) string {
+	name, _, _ := strings.Cut(key, countrySeparator)
+	return name
+}
+
+// Получаем значение, если оно есть и не устарело
+func (c *lru[T]) get(key string) (T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero T
+	elem, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+
+	entry := elem.Value.(*lruEntry[T])
+	if c.ttl > 0 && time.Now().After(entry.expires) {
+		c.removeElement(elem)
+		return zero, false
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+// Сохраняем значение, при необходимости вытесняя самое старое
+func (c *lru[T]) set(key string, value T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*lruEntry[T])
+		entry.value = value
+		entry.expires = expires
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry[T]{key: key, value: value, expires: expires})
+	name := keyName(key)
+	if c.names[name] == nil {
+		c.names[name] = make(map[string]struct{})
+	}
+	c.names[name][key] = struct{}{}
+
+	for c.order.Len() > c.size {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// Количество записей, включая устаревшие, но еще не вытесненные
+func (c *lru[T]) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// Удаляем все значения имени, в том числе уточненные по странам
+func (c *lru[T]) removeName(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.names[name] {
+		c.removeElement(c.items[key])
+	}
+}
+
+// Удаляем запись из списка, словаря и индекса по именам, вызывается под блокировкой
+func (c *lru[T]) removeElement(elem *list.Element) {
+	key := c.order.Remove(elem).(*lruEntry[T]).key
+	delete(c.items, key)
+
+	name := keyName(key)
+	delete(c.names[name], key)
+	if len(c.names[name]) == 0 {
+		delete(c.names, name)
+	}
+}
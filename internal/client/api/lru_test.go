@@ -0,0 +1,113 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		ttl     time.Duration
+		actions func(c *lru[int])
+		want    map[string]int
+		missing []string
+	}{
+		{
+			name: "get returns stored value",
+			size: 2,
+			actions: func(c *lru[int]) {
+				c.set("ivan", 1)
+			},
+			want: map[string]int{"ivan": 1},
+		},
+		{
+			name: "set overwrites value",
+			size: 2,
+			actions: func(c *lru[int]) {
+				c.set("ivan", 1)
+				c.set("ivan", 2)
+			},
+			want: map[string]int{"ivan": 2},
+		},
+		{
+			name: "oldest entry is evicted",
+			size: 2,
+			actions: func(c *lru[int]) {
+				c.set("ivan", 1)
+				c.set("petr", 2)
+				c.set("oleg", 3)
+			},
+			want:    map[string]int{"petr": 2, "oleg": 3},
+			missing: []string{"ivan"},
+		},
+		{
+			name: "get refreshes entry",
+			size: 2,
+			actions: func(c *lru[int]) {
+				c.set("ivan", 1)
+				c.set("petr", 2)
+				c.get("ivan")
+				c.set("oleg", 3)
+			},
+			want:    map[string]int{"ivan": 1, "oleg": 3},
+			missing: []string{"petr"},
+		},
+		{
+			name: "expired entry is missing",
+			size: 2,
+			ttl:  time.Nanosecond,
+			actions: func(c *lru[int]) {
+				c.set("ivan", 1)
+				time.Sleep(time.Millisecond)
+			},
+			missing: []string{"ivan"},
+		},
+		{
+			name: "removeName removes localized entries",
+			size: 4,
+			actions: func(c *lru[int]) {
+				c.set("ivan", 1)
+				c.set("ivan@RU", 2)
+				c.set("ivana", 3)
+				c.removeName("ivan")
+			},
+			want:    map[string]int{"ivana": 3},
+			missing: []string{"ivan", "ivan@RU"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newLRU[int](tt.size, tt.ttl)
+			tt.actions(c)
+
+			for key, want := range tt.want {
+				got, ok := c.get(key)
+				if !ok || got != want {
+					t.Errorf("get(%q) = %d, %v, want %d, true", key, got, ok, want)
+				}
+			}
+			for _, key := range tt.missing {
+				if got, ok := c.get(key); ok {
+					t.Errorf("get(%q) = %d, want missing", key, got)
+				}
+			}
+		})
+	}
+}
+
+func TestLRUNameIndex(t *testing.T) {
+	c := newLRU[int](2, 0)
+	c.set("ivan@RU", 1)
+	c.set("petr", 2)
+	c.set("oleg", 3)
+
+	if _, ok := c.names["ivan"]; ok {
+		t.Errorf("evicted name is still indexed")
+	}
+	if len(c.names) != c.len() {
+		t.Errorf("indexed %d names, want %d", len(c.names), c.len())
+	}
+}
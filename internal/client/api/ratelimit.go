@@ -0,0 +1,183 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Квота api исчерпана до времени сброса
+var ErrQuotaExhausted = errors.New("api quota exhausted")
+
+// Ошибка исчерпанной квоты со временем ее сброса
+type QuotaError struct {
+	Provider string
+	ResetAt  time.Time
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s: %s quota resets at %s", ErrQuotaExhausted, e.Provider, e.ResetAt.Format(time.RFC3339))
+}
+
+// Квота - частный случай превышения лимита запросов
+func (e *QuotaError) Unwrap() []error {
+	return []error{ErrRateLimited, ErrQuotaExhausted}
+}
+
+// Заголовки, в которых api сообщают о квоте
+const (
+	headerLimit     = "X-Rate-Limit-Limit"
+	headerRemaining = "X-Rate-Limit-Remaining"
+	headerReset     = "X-Rate-Limit-Reset"
+)
+
+// Оставшаяся квота api по последнему ответу
+type quota struct {
+	mu        sync.Mutex
+	known     bool
+	limit     int
+	remaining int
+	resetAt   time.Time
+}
+
+// Хватит ли квоты на запрос с count разными именами - каждое имя расходует единицу квоты
+func (q *quota) check(provider string, count int) error {
+	if available, err := q.available(provider, count); available < count {
+		return err
+	}
+	return nil
+}
+
+// Начало пакета, на разные имена которого хватает квоты. Если хватает не на все,
+// вместе с ним возвращается ошибка квоты для остальных имен
+func (q *quota) fit(provider string, names []string) ([]string, error) {
+	available, err := q.available(provider, uniqueNames(names))
+	if err == nil {
+		return names, nil
+	}
+
+	seen := make(map[string]bool, available)
+	for i, name := range names {
+		if !seen[name] && len(seen) == available {
+			return names[:i], err
+		}
+		seen[name] = true
+	}
+	return names, nil
+}
+
+// Сколько из count имен можно запросить до сброса квоты, если меньше count - с ошибкой квоты
+func (q *quota) available(provider string, count int) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.known || q.remaining >= count {
+		return count, nil
+	}
+	if !time.Now().Before(q.resetAt) {
+		// Квота уже сброшена - узнаем новое значение из следующего ответа
+		q.known = false
+		return count, nil
+	}
+
+	return max(q.remaining, 0), &QuotaError{Provider: provider, ResetAt: q.resetAt}
+}
+
+// Запоминаем квоту из заголовков ответа, 429 без заголовков тоже означает, что квота исчерпана
+func (q *quota) update(header http.Header, statusCode int) {
+	remaining, errRemaining := strconv.Atoi(header.Get(headerRemaining))
+	resetIn, errReset := strconv.Atoi(header.Get(headerReset))
+	if statusCode == http.StatusTooManyRequests && errRemaining != nil {
+		remaining, errRemaining = 0, nil
+	}
+	if errRemaining != nil {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.known = true
+	q.remaining = remaining
+	if limit, err := strconv.Atoi(header.Get(headerLimit)); err == nil {
+		q.limit = limit
+	}
+	if errReset == nil {
+		q.resetAt = time.Now().Add(time.Duration(resetIn) * time.Second)
+	} else if q.resetAt.Before(time.Now()) {
+		// Время сброса неизвестно - пробуем снова через минуту
+		q.resetAt = time.Now().Add(time.Minute)
+	}
+}
+
+// Ошибка исчерпанной квоты для ответа 429
+func (q *quota) error(provider string) *QuotaError {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return &QuotaError{Provider: provider, ResetAt: q.resetAt}
+}
+
+// Квота для отображения, ложь - если api о ней еще не сообщал
+func (q *quota) status() (limit int, remaining int, resetAt time.Time, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.limit, q.remaining, q.resetAt, q.known
+}
+
+// Ограничитель частоты запросов: rate запросов в секунду, не более burst подряд
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Ждем, пока можно будет отправить запрос
+func (b *tokenBucket) wait(ctx context.Context) error {
+	if b.rate <= 0 {
+		return nil
+	}
+
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestQuota(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     map[string]string
+		statusCode int
+		count      int
+		wantErr    bool
+	}{
+		{
+			name:    "unknown quota allows",
+			count:   10,
+			wantErr: false,
+		},
+		{
+			name:       "enough remaining",
+			header:     map[string]string{headerRemaining: "10", headerReset: "60"},
+			statusCode: http.StatusOK,
+			count:      10,
+			wantErr:    false,
+		},
+		{
+			name:       "not enough remaining",
+			header:     map[string]string{headerRemaining: "3", headerReset: "60"},
+			statusCode: http.StatusOK,
+			count:      4,
+			wantErr:    true,
+		},
+		{
+			name:       "429 without headers exhausts quota",
+			statusCode: http.StatusTooManyRequests,
+			count:      1,
+			wantErr:    true,
+		},
+		{
+			name:       "quota resets after reset time",
+			header:     map[string]string{headerRemaining: "0", headerReset: "0"},
+			statusCode: http.StatusOK,
+			count:      1,
+			wantErr:    false,
+		},
+		{
+			name:       "invalid header is ignored",
+			header:     map[string]string{headerRemaining: "many"},
+			statusCode: http.StatusOK,
+			count:      1,
+			wantErr:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var q quota
+			if tt.statusCode != 0 {
+				header := http.Header{}
+				for key, value := range tt.header {
+					header.Set(key, value)
+				}
+				q.update(header, tt.statusCode)
+			}
+
+			err := q.check("test", tt.count)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("check() = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !(errors.Is(err, ErrQuotaExhausted) && errors.Is(err, ErrRateLimited)) {
+				t.Errorf("check() = %v, want quota and rate limit error", err)
+			}
+		})
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     float64
+		burst    int
+		requests int
+		timeout  time.Duration
+		wantErr  bool
+	}{
+		{name: "no limit", rate: 0, burst: 0, requests: 100, timeout: time.Second},
+		{name: "within burst", rate: 1, burst: 5, requests: 5, timeout: 10 * time.Millisecond},
+		{name: "burst below one is one", rate: 1, burst: 0, requests: 1, timeout: 10 * time.Millisecond},
+		{name: "waits for refill", rate: 100, burst: 1, requests: 3, timeout: time.Second},
+		{name: "canceled while waiting", rate: 1, burst: 2, requests: 3, timeout: 10 * time.Millisecond, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			b := newTokenBucket(tt.rate, tt.burst)
+			var err error
+			for i := 0; i < tt.requests && err == nil; i++ {
+				err = b.wait(ctx)
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("wait() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestQuotaFit(t *testing.T) {
+	tests := []struct {
+		name      string
+		remaining string
+		names     []string
+		want      []string
+		wantErr   bool
+	}{
+		{name: "all fit", remaining: "5", names: []string{"ivan", "petr"}, want: []string{"ivan", "petr"}},
+		{name: "repeated name counted once", remaining: "1", names: []string{"ivan", "ivan"}, want: []string{"ivan", "ivan"}},
+		{name: "part fits", remaining: "2", names: []string{"ivan", "petr", "oleg"}, want: []string{"ivan", "petr"}, wantErr: true},
+		{name: "repeat inside fitting part", remaining: "2", names: []string{"ivan", "ivan", "petr", "oleg"}, want: []string{"ivan", "ivan", "petr"}, wantErr: true},
+		{name: "nothing fits", remaining: "0", names: []string{"ivan"}, want: []string{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var q quota
+			q.update(http.Header{headerRemaining: {tt.remaining}, headerReset: {"60"}}, http.StatusOK)
+
+			got, err := q.fit("test", tt.names)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fit() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrQuotaExhausted) {
+				t.Errorf("fit() error = %v, want %v", err, ErrQuotaExhausted)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("fit() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("fit() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
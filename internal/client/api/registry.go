@@ -0,0 +1,191 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+	"github.com/rs/zerolog"
+)
+
+// Источник данных для обогащения: внешний сервис, локальный словарь и т.п.
+type Provider interface {
+	// Получаем данные о возрасте сразу для нескольких имен, country - страна для уточнения прогноза
+	GetAges(ctx context.Context, names []string, country string) ([]models.AgeResult, error)
+	// Получаем данные о поле сразу для нескольких имен, country - страна для уточнения прогноза
+	GetGenders(ctx context.Context, names []string, country string) ([]models.GenderResult, error)
+	// Получаем данные о национальности сразу для нескольких имен
+	GetNations(ctx context.Context, names []string) ([]models.NationResult, error)
+	// Текущее состояние источника
+	Status() models.APIStatus
+	// Сбрасываем закэшированные результаты для имени
+	Forget(name string)
+}
+
+// Источник с названием для логов
+type NamedProvider struct {
+	Name     string
+	Provider Provider
+}
+
+// Часть имен не обработал ни один источник - результаты для остальных имен действительны
+type PartialError struct {
+	Err error
+	// Resolved[i] - результат для i-го имени получен
+	Resolved []bool
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("some names were not resolved by any provider: %v", e.Err)
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// Источники в порядке приоритета: имена, которые источник не определил или не смог обработать,
+// передаются следующему
+type registry struct {
+	logger    zerolog.Logger
+	providers []NamedProvider
+}
+
+// Получаем данные о возрасте сразу для нескольких имен
+func (r *registry) GetAges(ctx context.Context, names []string, country string) ([]models.AgeResult, error) {
+	return resolve(ctx, r, fieldAge, names, func(p Provider) func(context.Context, []string) ([]models.AgeResult, error) {
+		return func(ctx context.Context, names []string) ([]models.AgeResult, error) {
+			return p.GetAges(ctx, names, country)
+		}
+	}, func(result models.AgeResult) bool { return result.Found },
+		func(result *models.AgeResult, provider string) { result.Provider = provider })
+}
+
+// Получаем данные о поле сразу для нескольких имен
+func (r *registry) GetGenders(ctx context.Context, names []string, country string) ([]models.GenderResult, error) {
+	return resolve(ctx, r, fieldGender, names, func(p Provider) func(context.Context, []string) ([]models.GenderResult, error) {
+		return func(ctx context.Context, names []string) ([]models.GenderResult, error) {
+			return p.GetGenders(ctx, names, country)
+		}
+	}, func(result models.GenderResult) bool { return result.Found },
+		func(result *models.GenderResult, provider string) { result.Provider = provider })
+}
+
+// Получаем данные о национальности сразу для нескольких имен
+func (r *registry) GetNations(ctx context.Context, names []string) ([]models.NationResult, error) {
+	return resolve(ctx, r, fieldNation, names, func(p Provider) func(context.Context, []string) ([]models.NationResult, error) {
+		return p.GetNations
+	}, func(result models.NationResult) bool { return result.Found },
+		func(result *models.NationResult, provider string) { result.Provider = provider })
+}
+
+// Состояние всех источников
+func (r *registry) Status() models.APIStatus {
+	var status models.APIStatus
+	for _, p := range r.providers {
+		providerStatus := p.Provider.Status()
+		status.Providers = append(status.Providers, providerStatus.Providers...)
+		if providerStatus.Cache != nil {
+			status.Cache = providerStatus.Cache
+		}
+	}
+	return status
+}
+
+// Сбрасываем закэшированные результаты для имени во всех источниках
+func (r *registry) Forget(name string) {
+	for _, p := range r.providers {
+		p.Provider.Forget(name)
+	}
+}
+
+// Опрашиваем источники по порядку, пока все имена не будут определены.
+// Если имя не определил ни один источник, возвращается ответ последнего ответившего источника,
+// но только если ответили все источники - иначе для имени возвращается последняя ошибка.
+// В каждом результате отмечается название источника, который его вернул
+func resolve[T any](ctx context.Context, r *registry, field string, names []string,
+	method func(Provider) func(context.Context, []string) ([]T, error), found func(T) bool,
+	setProvider func(*T, string)) ([]T, error) {
+
+	results := make([]T, len(names))
+	answered := make([]bool, len(names))
+	failed := make([]bool, len(names))
+	pending := make([]int, 0, len(names))
+	for i := range names {
+		pending = append(pending, i)
+	}
+
+	var lastErr error
+	for _, p := range r.providers {
+		if len(pending) == 0 {
+			break
+		}
+
+		query := make([]string, 0, len(pending))
+		for _, i := range pending {
+			query = append(query, names[i])
+		}
+
+		// Источник мог обработать только часть имен - остальные передаем следующему
+		batch, err := method(p.Provider)(ctx, query)
+		var partial *PartialError
+		if err != nil && !errors.As(err, &partial) {
+			lastErr = err
+			for _, i := range pending {
+				failed[i] = true
+			}
+			r.logger.Debug().Err(err).Str("provider", p.Name).Str("field", field).Msg("provider failed, trying next one")
+			continue
+		}
+		if partial != nil {
+			lastErr = partial.Err
+			r.logger.Debug().Err(err).Str("provider", p.Name).Str("field", field).Msg("provider resolved only some names, trying next one")
+		}
+
+		next := pending[:0]
+		for j, i := range pending {
+			setProvider(&batch[j], p.Name)
+			if partial != nil && !partial.Resolved[j] {
+				failed[i] = true
+				next = append(next, i)
+				continue
+			}
+			results[i] = batch[j]
+			answered[i] = true
+			if !found(batch[j]) {
+				next = append(next, i)
+			}
+		}
+		pending = next
+	}
+
+	// Оставшиеся имена не определены: результат действителен, только если ни один источник не отказал
+	for _, i := range pending {
+		answered[i] = answered[i] && !failed[i]
+	}
+
+	unanswered := 0
+	for _, ok := range answered {
+		if !ok {
+			unanswered++
+		}
+	}
+	switch {
+	case unanswered == 0:
+		return results, nil
+	case lastErr == nil:
+		return nil, fmt.Errorf("%w: no enrichment providers configured", ErrUnavailable)
+	case unanswered == len(names):
+		return nil, lastErr
+	default:
+		return results, &PartialError{Err: lastErr, Resolved: answered}
+	}
+}
+
+// Объединяем источники в порядке приоритета
+func NewRegistry(logger zerolog.Logger, providers ...NamedProvider) UserAPI {
+	return &registry{
+		logger:    logger,
+		providers: providers,
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+	"github.com/rs/zerolog"
+)
+
+// Источник, который знает возраст только для заданных имен
+type ageProvider struct {
+	UserAPI
+	ages map[string]int
+}
+
+func (p *ageProvider) GetAges(ctx context.Context, names []string, country string) ([]models.AgeResult, error) {
+	results := make([]models.AgeResult, 0, len(names))
+	for _, name := range names {
+		age, ok := p.ages[name]
+		results = append(results, models.AgeResult{Name: name, Age: age, Found: ok})
+	}
+	return results, nil
+}
+
+func TestRegistryMarksProvider(t *testing.T) {
+	registry := NewRegistry(zerolog.Nop(),
+		NamedProvider{Name: models.ProviderLearned, Provider: &ageProvider{ages: map[string]int{"ivan": 40}}},
+		NamedProvider{Name: models.ProviderDictionary, Provider: &ageProvider{ages: map[string]int{"petr": 30}}},
+		NamedProvider{Name: models.ProviderWeb, Provider: &ageProvider{ages: map[string]int{"oleg": 20}}},
+	)
+
+	results, err := registry.GetAges(context.Background(), []string{"ivan", "petr", "oleg", "anna"}, "")
+	if err != nil {
+		t.Fatalf("GetAges() error = %v", err)
+	}
+
+	want := []struct {
+		age      int
+		found    bool
+		provider string
+	}{
+		{40, true, models.ProviderLearned},
+		{30, true, models.ProviderDictionary},
+		{20, true, models.ProviderWeb},
+		// Не определил никто - ответ последнего источника
+		{0, false, models.ProviderWeb},
+	}
+	for i, w := range want {
+		got := results[i]
+		if got.Age != w.age || got.Found != w.found || got.Provider != w.provider {
+			t.Errorf("results[%d] = %+v, want age %d, found %v, provider %q", i, got, w.age, w.found, w.provider)
+		}
+	}
+}
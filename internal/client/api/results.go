@@ -0,0 +1,168 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+)
+
+// Ответ agify.io
+type ageResponse struct {
+	Count int    `json:"count"`
+	Name  string `json:"name"`
+	Age   *int   `json:"age"`
+}
+
+// Ответ genderize.io
+type genderResponse struct {
+	Count       int     `json:"count"`
+	Name        string  `json:"name"`
+	Gender      *string `json:"gender"`
+	Probability float64 `json:"probability"`
+}
+
+// Ответ nationalize.io
+type nationResponse struct {
+	Count   int              `json:"count"`
+	Name    string           `json:"name"`
+	Country []models.Country `json:"country"`
+}
+
+// Разбираем и проверяем пакетный ответ - массив в порядке запрошенных имен
+func decodeAges(data []byte, names []string) ([]models.AgeResult, error) {
+	var resps []ageResponse
+	if err := json.Unmarshal(data, &resps); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	if len(resps) != len(names) {
+		return nil, fmt.Errorf("%w: got %d results for %d names", ErrInvalidResponse, len(resps), len(names))
+	}
+
+	results := make([]models.AgeResult, 0, len(resps))
+	for _, resp := range resps {
+		result, err := ageResult(resp)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func ageResult(resp ageResponse) (models.AgeResult, error) {
+
+	result := models.AgeResult{
+		Name:  resp.Name,
+		Count: resp.Count,
+	}
+	if resp.Age == nil {
+		return result, nil
+	}
+	if *resp.Age < 0 {
+		return models.AgeResult{}, fmt.Errorf("%w: negative age %d", ErrInvalidResponse, *resp.Age)
+	}
+
+	result.Age = *resp.Age
+	result.Found = true
+	return result, nil
+}
+
+// Разбираем и проверяем пакетный ответ - массив в порядке запрошенных имен
+func decodeGenders(data []byte, names []string) ([]models.GenderResult, error) {
+	var resps []genderResponse
+	if err := json.Unmarshal(data, &resps); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	if len(resps) != len(names) {
+		return nil, fmt.Errorf("%w: got %d results for %d names", ErrInvalidResponse, len(resps), len(names))
+	}
+
+	results := make([]models.GenderResult, 0, len(resps))
+	for _, resp := range resps {
+		result, err := genderResult(resp)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func genderResult(resp genderResponse) (models.GenderResult, error) {
+
+	result := models.GenderResult{
+		Name:  resp.Name,
+		Count: resp.Count,
+	}
+	if resp.Gender == nil {
+		return result, nil
+	}
+
+	gender := strings.ToLower(*resp.Gender)
+	if gender != models.GenderMale && gender != models.GenderFemale {
+		return models.GenderResult{}, fmt.Errorf("%w: unknown gender %q", ErrInvalidResponse, *resp.Gender)
+	}
+	if !validProbability(resp.Probability) {
+		return models.GenderResult{}, fmt.Errorf("%w: probability %v out of range", ErrInvalidResponse, resp.Probability)
+	}
+
+	result.Gender = gender
+	result.Probability = resp.Probability
+	result.Found = true
+	return result, nil
+}
+
+// Разбираем и проверяем пакетный ответ - массив в порядке запрошенных имен
+func decodeNations(data []byte, names []string) ([]models.NationResult, error) {
+	var resps []nationResponse
+	if err := json.Unmarshal(data, &resps); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	if len(resps) != len(names) {
+		return nil, fmt.Errorf("%w: got %d results for %d names", ErrInvalidResponse, len(resps), len(names))
+	}
+
+	results := make([]models.NationResult, 0, len(resps))
+	for _, resp := range resps {
+		result, err := nationResult(resp)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func nationResult(resp nationResponse) (models.NationResult, error) {
+
+	countries := make([]models.Country, 0, len(resp.Country))
+	for _, country := range resp.Country {
+		if len(country.Country_id) != 2 || !validProbability(country.Probability) {
+			return models.NationResult{}, fmt.Errorf("%w: invalid country %+v", ErrInvalidResponse, country)
+		}
+		country.Country_id = strings.ToUpper(country.Country_id)
+		countries = append(countries, country)
+	}
+
+	// Наиболее вероятная страна - первая
+	sort.SliceStable(countries, func(i, j int) bool {
+		return countries[i].Probability > countries[j].Probability
+	})
+
+	return models.NationResult{
+		Name:    resp.Name,
+		Count:   resp.Count,
+		Country: countries,
+		Found:   len(countries) > 0,
+	}, nil
+}
+
+func validProbability(p float64) bool {
+	return p >= 0 && p <= 1
+}
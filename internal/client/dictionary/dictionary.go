@@ -0,0 +1,207 @@
+package dictionary
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Yury132/Golang-Task-4/internal/client/api"
+	"github.com/Yury132/Golang-Task-4/internal/models"
+)
+
+// Название источника в состоянии api
+const providerName = "dictionary"
+
+// Запись словаря. Пустые поля означают, что значение для имени неизвестно
+type Entry struct {
+	Name string `json:"name"`
+	// male или female, допускаются также "м" и "ж"
+	Gender string `json:"gender"`
+	Age    int    `json:"age"`
+	// Код страны ISO 3166-1 alpha-2
+	Nation string `json:"nation"`
+}
+
+// Локальный словарь имен, который ведет команда, - работает без обращения к сети.
+// Значения словаря считаются достоверными, их вероятность равна 1, страна для уточнения не учитывается
+type dictionary struct {
+	entries map[string]Entry
+}
+
+// Получаем данные о возрасте сразу для нескольких имен
+func (d *dictionary) GetAges(ctx context.Context, names []string, country string) ([]models.AgeResult, error) {
+	results := make([]models.AgeResult, 0, len(names))
+	for _, name := range names {
+		result := models.AgeResult{Name: name}
+		if entry, ok := d.entries[key(name)]; ok && entry.Age > 0 {
+			result.Age = entry.Age
+			result.Found = true
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Получаем данные о поле сразу для нескольких имен
+func (d *dictionary) GetGenders(ctx context.Context, names []string, country string) ([]models.GenderResult, error) {
+	results := make([]models.GenderResult, 0, len(names))
+	for _, name := range names {
+		result := models.GenderResult{Name: name}
+		if entry, ok := d.entries[key(name)]; ok && entry.Gender != "" {
+			result.Gender = entry.Gender
+			result.Probability = 1
+			result.Found = true
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Получаем данные о национальности сразу для нескольких имен
+func (d *dictionary) GetNations(ctx context.Context, names []string) ([]models.NationResult, error) {
+	results := make([]models.NationResult, 0, len(names))
+	for _, name := range names {
+		result := models.NationResult{Name: name}
+		if entry, ok := d.entries[key(name)]; ok && entry.Nation != "" {
+			result.Country = []models.Country{{Country_id: entry.Nation, Probability: 1}}
+			result.Found = true
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Словарь всегда доступен
+func (d *dictionary) Status() models.APIStatus {
+	return models.APIStatus{
+		Providers: []models.ProviderStatus{{Name: providerName, State: "closed", Entries: len(d.entries)}},
+	}
+}
+
+// Словарь ничего не кэширует
+func (d *dictionary) Forget(name string) {}
+
+// Имена в словаре не зависят от регистра
+func key(name string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), "ё", "е")
+}
+
+// Загрузка словаря из файла .csv (с заголовком name,gender,age,nation) или .json (массив Entry)
+func Load(path string) (api.Provider, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening dictionary: %w", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err = json.NewDecoder(file).Decode(&entries); err != nil {
+			return nil, fmt.Errorf("failed decoding dictionary: %w", err)
+		}
+	case ".csv":
+		if entries, err = readCSV(file); err != nil {
+			return nil, fmt.Errorf("failed reading dictionary: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported dictionary format %q, use .csv or .json", filepath.Ext(path))
+	}
+
+	d := &dictionary{entries: make(map[string]Entry, len(entries))}
+	for i, entry := range entries {
+		if entry, err = normalize(entry); err != nil {
+			return nil, fmt.Errorf("dictionary entry %d: %w", i+1, err)
+		}
+		d.entries[key(entry.Name)] = entry
+	}
+
+	return d, nil
+}
+
+// Чтение CSV: колонки определяются по заголовку, лишние колонки пропускаются
+func readCSV(r io.Reader) ([]Entry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, fmt.Errorf("column \"name\" is required")
+	}
+
+	value := func(record []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var entries []Entry
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entry := Entry{
+			Name:   value(record, "name"),
+			Gender: value(record, "gender"),
+			Nation: value(record, "nation"),
+		}
+		if age := value(record, "age"); age != "" {
+			if entry.Age, err = strconv.Atoi(age); err != nil {
+				return nil, fmt.Errorf("invalid age %q for %q", age, entry.Name)
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Приводим запись к значениям api
+func normalize(entry Entry) (Entry, error) {
+	entry.Name = strings.TrimSpace(entry.Name)
+	if entry.Name == "" {
+		return entry, fmt.Errorf("name is empty")
+	}
+
+	switch strings.ToLower(strings.TrimSpace(entry.Gender)) {
+	case "":
+		entry.Gender = ""
+	case models.GenderMale, "м":
+		entry.Gender = models.GenderMale
+	case models.GenderFemale, "ж":
+		entry.Gender = models.GenderFemale
+	default:
+		return entry, fmt.Errorf("invalid gender %q for %q", entry.Gender, entry.Name)
+	}
+
+	if entry.Age < 0 {
+		return entry, fmt.Errorf("invalid age %d for %q", entry.Age, entry.Name)
+	}
+
+	entry.Nation = strings.ToUpper(strings.TrimSpace(entry.Nation))
+	if entry.Nation != "" && !models.IsCountryCode(entry.Nation) {
+		return entry, fmt.Errorf("invalid nation %q for %q", entry.Nation, entry.Name)
+	}
+
+	return entry, nil
+}
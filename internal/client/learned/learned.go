@@ -0,0 +1,154 @@
+package learned
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/Yury132/Golang-Task-4/internal/client/api"
+	"github.com/Yury132/Golang-Task-4/internal/models"
+)
+
+// Название источника в состоянии api
+const providerName = "learned"
+
+// Уверенность растет с количеством голосов: доля значения умножается на votes / (votes + confidencePrior),
+// так 5 единогласных голосов дают 0.71, 20 - 0.91
+const confidencePrior = 2
+
+// Поля, накопленные из исправлений операторов
+const (
+	fieldGender = models.FieldGender
+	fieldNation = models.FieldNation
+)
+
+type Storage interface {
+	// Накопленные из исправлений операторов значения для имен
+	GetNameStats(ctx context.Context, names []string) ([]models.NameStat, error)
+}
+
+// Пол и национальность, которые операторы указывали для имени.
+// Вероятность значения - его доля среди всех указанных для имени значений поля с поправкой
+// на количество голосов, страна для уточнения не учитывается
+type learned struct {
+	storage Storage
+	// Сколько раз операторы должны указать значения поля, чтобы им доверять
+	minVotes int
+}
+
+// Возраст из исправлений не накапливается
+func (l *learned) GetAges(ctx context.Context, names []string, country string) ([]models.AgeResult, error) {
+	results := make([]models.AgeResult, 0, len(names))
+	for _, name := range names {
+		results = append(results, models.AgeResult{Name: name})
+	}
+	return results, nil
+}
+
+// Получаем данные о поле сразу для нескольких имен
+func (l *learned) GetGenders(ctx context.Context, names []string, country string) ([]models.GenderResult, error) {
+	stats, err := l.stats(ctx, names, fieldGender)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]models.GenderResult, 0, len(names))
+	for _, name := range names {
+		result := models.GenderResult{Name: name}
+		if values, total := stats[key(name)], votes(stats[key(name)]); total >= l.minVotes && total > 0 {
+			result.Gender = values[0].Value
+			result.Probability = confidence(values[0].Votes, total)
+			result.Count = total
+			result.Found = true
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Получаем данные о национальности сразу для нескольких имен
+func (l *learned) GetNations(ctx context.Context, names []string) ([]models.NationResult, error) {
+	stats, err := l.stats(ctx, names, fieldNation)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]models.NationResult, 0, len(names))
+	for _, name := range names {
+		result := models.NationResult{Name: name}
+		if values, total := stats[key(name)], votes(stats[key(name)]); total >= l.minVotes && total > 0 {
+			for _, value := range values {
+				result.Country = append(result.Country, models.Country{
+					Country_id:  value.Value,
+					Probability: confidence(value.Votes, total),
+				})
+			}
+			result.Count = total
+			result.Found = true
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Накопленные значения поля по именам, по убыванию количества голосов
+func (l *learned) stats(ctx context.Context, names []string, field string) (map[string][]models.NameStat, error) {
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		keys = append(keys, key(name))
+	}
+
+	stats, err := l.storage.GetNameStats(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string][]models.NameStat)
+	for _, stat := range stats {
+		if stat.Field == field {
+			byName[stat.Name] = append(byName[stat.Name], stat)
+		}
+	}
+	for _, values := range byName {
+		sort.SliceStable(values, func(i, j int) bool { return values[i].Votes > values[j].Votes })
+	}
+
+	return byName, nil
+}
+
+// Всего голосов за значения поля
+func votes(values []models.NameStat) int {
+	total := 0
+	for _, value := range values {
+		total += value.Votes
+	}
+	return total
+}
+
+// Доля голосов за значение, уменьшенная при малом количестве голосов
+func confidence(valueVotes int, total int) float64 {
+	// valueVotes / total * total / (total + confidencePrior)
+	return float64(valueVotes) / float64(total+confidencePrior)
+}
+
+// Накопленные значения читаются из БД при каждом запросе
+func (l *learned) Status() models.APIStatus {
+	return models.APIStatus{
+		Providers: []models.ProviderStatus{{Name: providerName, State: "closed"}},
+	}
+}
+
+// Ничего не кэшируется
+func (l *learned) Forget(name string) {}
+
+// Имена хранятся в нижнем регистре
+func key(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func New(storage Storage, minVotes int) api.Provider {
+	return &learned{
+		storage:  storage,
+		minVotes: minVotes,
+	}
+}
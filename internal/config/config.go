@@ -39,6 +39,77 @@ type Config struct {
 		Port     int    `envconfig:"DB_PORT"`
 		MaxConn  int    `envconfig:"DB_MAX_CONN"`
 	}
+
+	// Внешние api для обогащения данных пользователя
+	API struct {
+		// Источники данных в порядке приоритета: learned - значения из исправлений операторов,
+		// dictionary - локальный словарь, web - внешние api
+		Providers []string `envconfig:"API_PROVIDERS" default:"learned,dictionary,web"`
+		// Сколько раз операторы должны указать пол или национальность для имени, чтобы им доверять
+		LearnedMinVotes int `envconfig:"API_LEARNED_MIN_VOTES" default:"5"`
+		// Файл локального словаря имен .csv или .json, пусто - словарь не используется
+		DictionaryPath string `envconfig:"API_DICTIONARY_PATH"`
+		// Базовые адреса сервисов - можно указать зеркало или локальную заглушку
+		AgeURL    string `envconfig:"API_AGE_URL" default:"https://api.agify.io"`
+		GenderURL string `envconfig:"API_GENDER_URL" default:"https://api.genderize.io"`
+		NationURL string `envconfig:"API_NATION_URL" default:"https://api.nationalize.io"`
+		// Ключ для платных тарифов
+		Key string `envconfig:"API_KEY"`
+		// Ограничение времени на один запрос
+		Timeout time.Duration `envconfig:"API_TIMEOUT" default:"5s"`
+		// Количество повторов при недоступности api и паузы между ними
+		Retries        int           `envconfig:"API_RETRIES" default:"2"`
+		RetryBaseDelay time.Duration `envconfig:"API_RETRY_BASE_DELAY" default:"200ms"`
+		RetryMaxDelay  time.Duration `envconfig:"API_RETRY_MAX_DELAY" default:"2s"`
+		// Сколько неудачных запросов подряд отключают api и на какое время
+		BreakerThreshold int           `envconfig:"API_BREAKER_THRESHOLD" default:"5"`
+		BreakerCooldown  time.Duration `envconfig:"API_BREAKER_COOLDOWN" default:"30s"`
+		// Частота запросов к каждому api в секунду и допустимое количество запросов подряд, 0 - без ограничения
+		RateLimit float64 `envconfig:"API_RATE_LIMIT" default:"5"`
+		RateBurst int     `envconfig:"API_RATE_BURST" default:"10"`
+		// Общее ограничение времени на все запросы по одному пользователю
+		EnrichTimeout time.Duration `envconfig:"API_ENRICH_TIMEOUT" default:"10s"`
+		// Размер кэша результатов для каждого из api, 0 - кэш отключен
+		CacheSize int `envconfig:"API_CACHE_SIZE" default:"1000"`
+		// Время жизни записи в кэше
+		CacheTTL time.Duration `envconfig:"API_CACHE_TTL" default:"24h"`
+		// Через сколько сохраненные в БД результаты считаются устаревшими, 0 - никогда
+		StoredTTL time.Duration `envconfig:"API_STORED_TTL" default:"720h"`
+		// Транслитерация имен на кириллице: icao, gost или пусто - не транслитерировать
+		Translit string `envconfig:"API_TRANSLIT" default:"icao"`
+		// Уточнять возраст и пол по наиболее вероятной стране имени (параметр country_id)
+		Localize bool `envconfig:"API_LOCALIZE" default:"true"`
+		// Страна для уточнения, если национальность не определена, пусто - не уточнять
+		DefaultCountry string `envconfig:"API_DEFAULT_COUNTRY"`
+	}
+
+	// Фоновое обогащение пользователей
+	Worker struct {
+		// Количество обработчиков и размер захватываемой ими пачки
+		Count     int `envconfig:"WORKER_COUNT" default:"2"`
+		BatchSize int `envconfig:"WORKER_BATCH_SIZE" default:"10"`
+		// Пауза при пустой очереди
+		PollInterval time.Duration `envconfig:"WORKER_POLL_INTERVAL" default:"1s"`
+		// На сколько захватывается пользователь - за это время обработчик должен успеть
+		TaskLease time.Duration `envconfig:"WORKER_TASK_LEASE" default:"2m"`
+		// Количество попыток и пауза между ними, пауза растет вдвое до RetryMaxDelay
+		MaxAttempts   int           `envconfig:"WORKER_MAX_ATTEMPTS" default:"5"`
+		RetryDelay    time.Duration `envconfig:"WORKER_RETRY_DELAY" default:"30s"`
+		RetryMaxDelay time.Duration `envconfig:"WORKER_RETRY_MAX_DELAY" default:"1h"`
+	}
+
+	// Список пользователей
+	List struct {
+		// Размер страницы по умолчанию и наибольший, который можно запросить
+		PageSize    int `envconfig:"LIST_PAGE_SIZE" default:"50"`
+		MaxPageSize int `envconfig:"LIST_MAX_PAGE_SIZE" default:"500"`
+	}
+
+	// Проверка результатов api операторами
+	Review struct {
+		// Пол и национальность с меньшей вероятностью попадают на проверку
+		Threshold float64 `envconfig:"REVIEW_THRESHOLD" default:"0.7"`
+	}
 }
 
 func Parse() (*Config, error) {
@@ -56,6 +127,14 @@ func Parse() (*Config, error) {
 		return nil, errors.Wrap(err, "failed to process env vars")
 	}
 
+	// Без обработчиков пользователи навсегда останутся в очереди
+	if cfg.Worker.Count <= 0 {
+		return nil, errors.Errorf("WORKER_COUNT must be positive, got %d", cfg.Worker.Count)
+	}
+	if cfg.Worker.BatchSize <= 0 {
+		return nil, errors.Errorf("WORKER_BATCH_SIZE must be positive, got %d", cfg.Worker.BatchSize)
+	}
+
 	return cfg, nil
 }
 
@@ -0,0 +1,16 @@
+-- +goose Up
+create table if not exists public.name_enrichment
+(
+    name varchar(100) not null primary key,
+    age integer,
+    age_count integer not null default 0,
+    gender varchar(6),
+    gender_probability double precision not null default 0,
+    gender_count integer not null default 0,
+    nation jsonb not null default '[]',
+    nation_count integer not null default 0,
+    fetched_at timestamptz not null default now()
+);
+
+-- +goose Down
+drop table public.name_enrichment;
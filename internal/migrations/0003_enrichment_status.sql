@@ -0,0 +1,22 @@
+-- +goose Up
+-- Уже существующие пользователи обогащены при создании
+alter table public.users
+    add column if not exists enrichment_status varchar(10) not null default 'enriched',
+    add column if not exists enrichment_attempts integer not null default 0,
+    add column if not exists enrichment_next_at timestamptz,
+    add column if not exists enrichment_error text;
+
+alter table public.users alter column enrichment_status set default 'pending';
+
+create index if not exists users_enrichment_queue_idx
+    on public.users (enrichment_next_at nulls first, id)
+    where enrichment_status = 'pending';
+
+-- +goose Down
+drop index if exists public.users_enrichment_queue_idx;
+
+alter table public.users
+    drop column if exists enrichment_status,
+    drop column if exists enrichment_attempts,
+    drop column if exists enrichment_next_at,
+    drop column if exists enrichment_error;
@@ -0,0 +1,25 @@
+-- +goose Up
+alter table public.users
+    add column if not exists age_count integer,
+    add column if not exists gender_probability double precision,
+    add column if not exists nation_probability double precision;
+
+-- Все страны, предложенные api для пользователя
+create table if not exists public.user_nationalities
+(
+    user_id integer not null references public.users (id) on delete cascade,
+    country_id varchar(2) not null,
+    probability double precision not null,
+    primary key (user_id, country_id)
+);
+
+create index if not exists user_nationalities_country_idx
+    on public.user_nationalities (country_id, probability);
+
+-- +goose Down
+drop table public.user_nationalities;
+
+alter table public.users
+    drop column if exists age_count,
+    drop column if exists gender_probability,
+    drop column if exists nation_probability;
@@ -0,0 +1,24 @@
+-- +goose Up
+-- Когда оператор проверил данные, полученные от api
+alter table public.users
+    add column if not exists reviewed_at timestamptz;
+
+-- Решения операторов по каждому полю
+create table if not exists public.enrichment_reviews
+(
+    id serial not null primary key,
+    user_id integer not null references public.users (id) on delete cascade,
+    field varchar(10) not null,
+    action varchar(10) not null,
+    old_value varchar(100) not null,
+    new_value varchar(100) not null,
+    reviewer varchar(100) not null,
+    created_at timestamptz not null default now()
+);
+
+create index if not exists enrichment_reviews_user_idx on public.enrichment_reviews (user_id);
+
+-- +goose Down
+drop table public.enrichment_reviews;
+
+alter table public.users drop column if exists reviewed_at;
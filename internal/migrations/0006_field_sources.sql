@@ -0,0 +1,31 @@
+-- +goose Up
+-- Откуда взято значение каждого обогащаемого поля: api, оператор или импорт
+create table if not exists public.user_field_sources
+(
+    user_id integer not null references public.users (id) on delete cascade,
+    field varchar(10) not null,
+    source varchar(10) not null,
+    actor varchar(100),
+    updated_at timestamptz not null default now(),
+    primary key (user_id, field)
+);
+
+-- Уже заполненные поля получены от api
+insert into public.user_field_sources (user_id, field, source, updated_at)
+select id, 'age', 'api', now() from public.users where age is not null
+union all
+select id, 'gender', 'api', now() from public.users where gender is not null
+union all
+select id, 'nation', 'api', now() from public.users where nation is not null
+on conflict do nothing;
+
+-- Кроме проверенных операторами
+insert into public.user_field_sources (user_id, field, source, actor, updated_at)
+select distinct on (user_id, field) user_id, field, 'manual', reviewer, created_at
+from public.enrichment_reviews
+order by user_id, field, created_at desc
+on conflict (user_id, field) do update
+    set source = excluded.source, actor = excluded.actor, updated_at = excluded.updated_at;
+
+-- +goose Down
+drop table public.user_field_sources;
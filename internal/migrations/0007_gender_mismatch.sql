@@ -0,0 +1,20 @@
+-- +goose Up
+-- Пол, определенный api, не совпадает с полом по отчеству
+alter table public.users
+    add column if not exists gender_mismatch boolean not null default false;
+
+-- Раньше пользователям, для которых api не определил пол, записывался "ж" -
+-- убираем такие значения, их заполнит повторное обогащение
+update public.users set gender = null
+where gender_probability = 0
+  and not exists (
+    select 1 from public.user_field_sources f
+    where f.user_id = users.id and f.field = 'gender' and f.source in ('manual', 'import')
+  );
+
+delete from public.user_field_sources f
+using public.users u
+where f.user_id = u.id and f.field = 'gender' and u.gender is null;
+
+-- +goose Down
+alter table public.users drop column if exists gender_mismatch;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- Пол и национальность для имен, накопленные из исправлений операторов
+create table if not exists public.name_stats
+(
+    name varchar(100) not null,
+    field varchar(10) not null,
+    value varchar(10) not null,
+    votes integer not null default 0,
+    updated_at timestamptz not null default now(),
+    primary key (name, field, value)
+);
+
+-- +goose Down
+drop table public.name_stats;
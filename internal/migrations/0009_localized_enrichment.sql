@@ -0,0 +1,18 @@
+-- +goose Up
+-- Страна, по данным которой api уточнил возраст и пол (параметр country_id), NULL - без уточнения
+alter table public.users
+    add column if not exists age_country varchar(2),
+    add column if not exists gender_country varchar(2);
+
+alter table public.name_enrichment
+    add column if not exists age_country varchar(2),
+    add column if not exists gender_country varchar(2);
+
+-- +goose Down
+alter table public.name_enrichment
+    drop column if exists age_country,
+    drop column if exists gender_country;
+
+alter table public.users
+    drop column if exists age_country,
+    drop column if exists gender_country;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Время добавления пользователя для отбора по дате, существующим пользователям ставится время миграции
+alter table public.users
+    add column if not exists created_at timestamptz not null default now();
+
+-- +goose Down
+alter table public.users
+    drop column if exists created_at;
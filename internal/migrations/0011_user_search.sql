@@ -0,0 +1,20 @@
+-- +goose Up
+-- Поиск пользователей по ФИО: полнотекстовый по словам и триграммный - с опечатками
+create extension if not exists pg_trgm;
+
+alter table public.users
+    add column if not exists full_name text
+        generated always as (surname || ' ' || name || ' ' || patronymic) stored,
+    add column if not exists search_vector tsvector
+        generated always as (to_tsvector('simple', surname || ' ' || name || ' ' || patronymic)) stored;
+
+create index if not exists users_search_vector_idx on public.users using gin (search_vector);
+create index if not exists users_full_name_trgm_idx on public.users using gin (full_name gin_trgm_ops);
+
+-- +goose Down
+drop index if exists public.users_full_name_trgm_idx;
+drop index if exists public.users_search_vector_idx;
+
+alter table public.users
+    drop column if exists search_vector,
+    drop column if exists full_name;
@@ -0,0 +1,34 @@
+-- +goose Up
+-- Пользователи с одинаковым ФИО без учета регистра и пробелов по краям - дубликаты.
+-- Удалять их автоматически нельзя - прерываем миграцию со списком групп,
+-- дубликаты нужно объединить или исправить вручную и запустить приложение снова
+-- +goose StatementBegin
+do $$
+declare
+    groups_count integer;
+    groups_list text;
+begin
+    select count(*), string_agg(ids, '; ' order by n) filter (where n <= 20)
+    into groups_count, groups_list
+    from (
+        select format('%s %s %s (ID %s)', min(surname), min(name), min(patronymic),
+                      string_agg(id::text, ', ' order by id)) as ids,
+               row_number() over (order by min(id)) as n
+        from public.users
+        group by lower(btrim(name)), lower(btrim(surname)), lower(btrim(patronymic))
+        having count(*) > 1
+    ) duplicates;
+
+    if groups_count > 0 then
+        raise exception 'found % groups of users with the same full name, merge them before creating unique index: %',
+            groups_count, groups_list;
+    end if;
+end
+$$;
+-- +goose StatementEnd
+
+create unique index if not exists users_full_name_unique_idx
+    on public.users (lower(btrim(name)), lower(btrim(surname)), lower(btrim(patronymic)));
+
+-- +goose Down
+drop index if exists public.users_full_name_unique_idx;
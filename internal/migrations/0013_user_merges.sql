@@ -0,0 +1,17 @@
+-- +goose Up
+-- Журнал слияния дубликатов: оба пользователя до слияния и поля, взятые у удаленного.
+-- Ссылок на users нет - записи журнала остаются и после удаления пользователей
+create table if not exists public.user_merges
+(
+    id serial not null primary key,
+    kept_user_id integer not null,
+    removed_user_id integer not null,
+    kept_user jsonb not null,
+    removed_user jsonb not null,
+    fields varchar(20)[] not null,
+    merger varchar(100) not null,
+    created_at timestamptz not null default now()
+);
+
+-- +goose Down
+drop table public.user_merges;
@@ -0,0 +1,32 @@
+-- +goose Up
+-- Старые пользователи, обогащенные до появления вероятностей, имеют пустую gender_probability
+-- и тоже могли получить "ж" вместо неопределенного пола. Убираем такие значения,
+-- если пол не задан оператором, импортом или по отчеству, и возвращаем пользователей в очередь обогащения
+create temporary table legacy_gender on commit drop as
+select u.id
+from public.users u
+where u.gender is not null
+  and coalesce(u.gender_probability, 0) = 0
+  and not exists (
+    select 1 from public.user_field_sources f
+    where f.user_id = u.id and f.field = 'gender' and f.source <> 'api'
+  );
+
+update public.users u
+set gender = null,
+    gender_probability = null,
+    gender_country = null,
+    gender_mismatch = false,
+    enrichment_status = 'pending',
+    enrichment_attempts = 0,
+    enrichment_next_at = null,
+    enrichment_error = null
+from legacy_gender l
+where u.id = l.id;
+
+delete from public.user_field_sources f
+using legacy_gender l
+where f.user_id = l.id and f.field = 'gender';
+
+-- +goose Down
+-- Удаленные значения пола не восстанавливаются - их заполнит повторное обогащение
@@ -0,0 +1,11 @@
+-- +goose Up
+-- Индексы для постраничного списка пользователей: выражения совпадают с sortColumns в storage/cursor.go,
+-- id в конце дает однозначный порядок для курсора
+create index if not exists users_surname_sort_idx on public.users (surname, id);
+create index if not exists users_age_sort_idx on public.users ((coalesce(age, 0)), id);
+create index if not exists users_nation_sort_idx on public.users ((coalesce(nation, '')), id);
+
+-- +goose Down
+drop index if exists public.users_surname_sort_idx;
+drop index if exists public.users_age_sort_idx;
+drop index if exists public.users_nation_sort_idx;
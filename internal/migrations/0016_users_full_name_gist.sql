@@ -0,0 +1,6 @@
+-- +goose Up
+-- Индекс для поиска ближайших по триграммам ФИО (оператор <->) при поиске дубликатов
+create index if not exists users_full_name_trgm_gist_idx on public.users using gist (full_name gist_trgm_ops);
+
+-- +goose Down
+drop index if exists public.users_full_name_trgm_gist_idx;
@@ -1,5 +1,10 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type User struct {
 	ID         uint64 `json:"id"`
 	Name       string `json:"name"`
@@ -8,28 +13,402 @@ type User struct {
 	Age        int    `json:"age"`
 	Gender     string `json:"gender"`
 	Nation     string `json:"nation"`
+	// Количество записей, на основе которых api определил возраст
+	AgeCount int `json:"age_count"`
+	// Уверенность api в поле и национальности
+	GenderProbability float64 `json:"gender_probability"`
+	NationProbability float64 `json:"nation_probability"`
+	// Страна, по данным которой api уточнил возраст и пол, пусто - без уточнения
+	AgeCountry    string `json:"age_country,omitempty"`
+	GenderCountry string `json:"gender_country,omitempty"`
+	// Все страны, предложенные api, по убыванию вероятности - заполняется только для одного пользователя
+	Nationalities []Country `json:"nationalities,omitempty"`
+	// Пол, определенный api, не совпадает с полом по отчеству
+	GenderMismatch bool `json:"gender_mismatch"`
+	// Состояние заполнения возраста, пола и национальности
+	EnrichmentStatus string `json:"enrichment_status"`
+	// Когда пользователь добавлен
+	CreatedAt time.Time `json:"created_at"`
+	// Откуда взяты возраст, пол и национальность - заполняется только для одного пользователя
+	Sources []FieldSource `json:"sources,omitempty"`
 }
 
-// Структура получаемого возраста от внешнего api
-type AgeApi struct {
-	Count int    `json:"count"`
+// Источник значения поля, nil - источник неизвестен
+func (u User) Source(field string) *FieldSource {
+	for i := range u.Sources {
+		if u.Sources[i].Field == field {
+			return &u.Sources[i]
+		}
+	}
+	return nil
+}
+
+// Значение поля может быть заменено данными api - оно получено автоматически, а не задано вручную или импортировано
+func (u User) APIOwned(field string) bool {
+	source := u.Source(field)
+	return source == nil || (source.Source != SourceManual && source.Source != SourceImport)
+}
+
+// Поля пользователя, заполняемые api
+const (
+	FieldAge    = "age"
+	FieldGender = "gender"
+	FieldNation = "nation"
+)
+
+// Источники значений полей
+const (
+	// Получено от внешнего api
+	SourceAPI = "api"
+	// Задано оператором
+	SourceManual = "manual"
+	// Передано при импорте
+	SourceImport = "import"
+	// Пол определен по отчеству, так как api его не определил
+	SourcePatronymic = "patronymic"
+	// Значение из исправлений операторов для имени
+	SourceLearned = "learned"
+	// Значение из локального словаря имен
+	SourceDictionary = "dictionary"
+)
+
+// Источники данных для обогащения, названия из настройки API_PROVIDERS
+const (
+	ProviderLearned    = "learned"
+	ProviderDictionary = "dictionary"
+	ProviderWeb        = "web"
+)
+
+// Откуда и когда получено значение поля пользователя
+type FieldSource struct {
+	Field  string `json:"field"`
+	Source string `json:"source"`
+	// Кто задал значение, пусто для api и импорта
+	Actor     string    `json:"actor,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Состояния обогащения пользователя
+const (
+	// Ожидает обращения к api
+	EnrichmentPending = "pending"
+	// Поля заполнены
+	EnrichmentEnriched = "enriched"
+	// Попытки исчерпаны, часть полей не заполнена
+	EnrichmentFailed = "failed"
+)
+
+// Пользователь, ожидающий обогащения
+type EnrichmentTask struct {
+	ID   int
+	Name string
+	// Для определения пола, если api его не определил
+	Patronymic string
+	// Сколько раз уже пытались обогатить
+	Attempts int
+}
+
+// Результат обогащения пользователя для сохранения
+type EnrichmentUpdate struct {
+	ID int
+	// Пустые значения не меняют поле, уверенность api меняется вместе со своим полем
+	Age               int
+	AgeCount          int
+	Gender            string
+	GenderProbability float64
+	Nation            string
+	NationProbability float64
+	// Все страны, предложенные api
+	Nationalities []Country
+	// Откуда взяты возраст, пол и национальность, пусто - от api
+	AgeSource    string
+	GenderSource string
+	NationSource string
+	// Пол от api не совпадает с полом по отчеству
+	GenderMismatch bool
+	// Страна, по данным которой api уточнил возраст и пол, меняется вместе со своим полем
+	AgeCountry    string
+	GenderCountry string
+	// Новое состояние и количество попыток
+	Status   string
+	Attempts int
+	// Когда повторить, если состояние остается EnrichmentPending
+	NextAt time.Time
+	// Причина неудачи
+	Error string
+}
+
+// Итог массового добавления пользователей
+type ImportResult struct {
+	// Сколько пользователей получено
+	Total int `json:"total"`
+	// Сколько добавлено в БД
+	Created int `json:"created"`
+	// Сколько пропущено, так как такой пользователь уже есть
+	Skipped int `json:"skipped"`
+}
+
+// Условия отбора пользователей, пустые условия не применяются
+type UserFilter struct {
+	// Возраст от и до включительно, 0 - без ограничения
+	AgeMin int `json:"age_min"`
+	AgeMax int `json:"age_max"`
+	// Пол в обозначении БД: "м" или "ж"
+	Gender string `json:"gender"`
+	// Любая из указанных национальностей
+	Nations []string `json:"nations"`
+	// Если задана, национальность ищется среди всех предложенных api стран с не меньшей вероятностью
+	MinNationProbability float64 `json:"min_nation_probability"`
+	// Часть фамилии, имени или отчества без учета регистра
+	Name string `json:"name"`
+	// Время добавления: с CreatedFrom включительно до CreatedTo, нулевое время - без ограничения
+	CreatedFrom time.Time `json:"created_from"`
+	CreatedTo   time.Time `json:"created_to"`
+}
+
+// Найденный по ФИО пользователь
+type SearchResult struct {
+	User User `json:"user"`
+	// Насколько пользователь соответствует запросу, больше - лучше
+	Rank float64 `json:"rank"`
+	// ФИО по частям с отметкой совпавших с запросом слов
+	Highlight []Highlight `json:"highlight"`
+}
+
+// Часть ФИО в результатах поиска
+type Highlight struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match"`
+}
+
+// Поля ФИО
+const (
+	FieldName       = "name"
+	FieldSurname    = "surname"
+	FieldPatronymic = "patronymic"
+)
+
+// Два пользователя, которые, возможно, являются одним человеком
+type DuplicatePair struct {
+	First  User `json:"first"`
+	Second User `json:"second"`
+	// Сколько букв различается в нормализованных ФИО, 0 - ФИО совпадают после нормализации
+	Distance int `json:"distance"`
+}
+
+// Слияние двух пользователей в одного
+type MergeRequest struct {
+	// Пользователь, который остается
+	KeepID int `json:"keep_id"`
+	// Пользователь, который удаляется после слияния
+	RemoveID int `json:"remove_id"`
+	// Поля, значения которых берутся у удаляемого пользователя: name, surname, patronymic, age, gender, nation.
+	// Остальные поля остаются как у сохраняемого пользователя
+	Take []string `json:"take"`
+	// Кто выполнил слияние
+	Merger string `json:"merger"`
+}
+
+// Запись журнала слияний
+type Merge struct {
+	ID            int             `json:"id"`
+	KeptUserID    int             `json:"kept_user_id"`
+	RemovedUserID int             `json:"removed_user_id"`
+	KeptUser      json.RawMessage `json:"kept_user"`
+	RemovedUser   json.RawMessage `json:"removed_user"`
+	Fields        []string        `json:"fields"`
+	Merger        string          `json:"merger"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// Поля, по которым сортируется список пользователей
+const (
+	SortID      = "id"
+	SortSurname = "surname"
+	SortAge     = "age"
+	SortNation  = "nation"
+)
+
+// Запрашиваемая страница списка пользователей
+type PageRequest struct {
+	// Поле сортировки, пусто - по ID
+	Sort string `json:"sort"`
+	// Сортировка по убыванию
+	Desc bool `json:"desc"`
+	// Сколько пользователей на странице, 0 - по умолчанию
+	Limit int `json:"limit"`
+	// Страница после курсора After или перед курсором Before, оба пустые - первая страница
+	After  string `json:"after,omitempty"`
+	Before string `json:"before,omitempty"`
+}
+
+// Страница списка пользователей
+type UserPage struct {
+	Users []User `json:"users"`
+	// Курсоры для следующей и предыдущей страницы, пусто - страницы нет
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// Параметры повторного обогащения пользователей
+type ReenrichOptions struct {
+	// Конкретный пользователь, 0 - любой
+	ID int `json:"id"`
+	// Только пользователи с указанным состоянием обогащения
+	Status string `json:"status"`
+	// Только пользователи с незаполненным возрастом, полом или национальностью
+	Incomplete bool `json:"incomplete"`
+	// Все пользователи - должно быть указано явно, если не задано других условий
+	All bool `json:"all"`
+	// Только показать изменения, не сохраняя их. Данные берутся так же, как при настоящем запуске:
+	// сохраненные результаты api, а для имен без них - запрос к api
+	DryRun bool `json:"dry_run"`
+}
+
+// Условия не заданы - без All такой запуск считается ошибкой
+func (o ReenrichOptions) Empty() bool {
+	return o.ID == 0 && o.Status == "" && !o.Incomplete
+}
+
+// Итог повторного обогащения
+type ReenrichResult struct {
+	DryRun bool `json:"dry_run"`
+	// Сколько пользователей проверено
+	Checked int `json:"checked"`
+	// Сколько пользователей изменено (или будет изменено при DryRun)
+	Changed int `json:"changed"`
+	// Пользователи с изменениями или ошибками
+	Users []UserChanges `json:"users"`
+}
+
+// Изменения полей одного пользователя
+type UserChanges struct {
+	ID      uint64        `json:"id"`
+	Changes []FieldChange `json:"changes,omitempty"`
+	// Поля, которые не удалось получить у api
+	Error string `json:"error,omitempty"`
+}
+
+// Изменение одного поля
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Изменение пользователя вручную, пустые значения оставляют поле без изменений
+type UserEdit struct {
+	Name       string `json:"name"`
+	Surname    string `json:"surname"`
+	Patronymic string `json:"patronymic"`
+	Age        int    `json:"age"`
+	Gender     string `json:"gender"`
+	Nation     string `json:"nation"`
+	// Кто изменил
+	Editor string `json:"editor"`
+}
+
+// Значения полей, указанные оператором при проверке
+type ReviewValues struct {
+	// Кто проверял
+	Reviewer string `json:"reviewer"`
+	Age      int    `json:"age"`
+	Gender   string `json:"gender"`
+	Nation   string `json:"nation"`
+}
+
+// Действия оператора над полем
+const (
+	// Значение api верно
+	ReviewConfirm = "confirm"
+	// Значение api заменено
+	ReviewOverride = "override"
+)
+
+// Решение оператора по одному полю
+type ReviewDecision struct {
+	Field    string `json:"field"`
+	Action   string `json:"action"`
+	OldValue string `json:"old_value"`
+	NewValue string `json:"new_value"`
+}
+
+// Проверка пользователя оператором
+type Review struct {
+	UserID    int              `json:"user_id"`
+	Reviewer  string           `json:"reviewer"`
+	Decisions []ReviewDecision `json:"decisions"`
+	// Значения полей после проверки
+	Age    int    `json:"age"`
+	Gender string `json:"gender"`
+	Nation string `json:"nation"`
+}
+
+// Значение поля для имени, накопленное из исправлений операторов
+type NameStat struct {
+	// Имя в нижнем регистре
 	Name  string `json:"name"`
-	Age   int    `json:"age"`
+	Field string `json:"field"`
+	// Для пола - GenderMale или GenderFemale, для национальности - код страны
+	Value string `json:"value"`
+	// Сколько раз операторы указали это значение
+	Votes     int       `json:"votes"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
-// Структура получаемого пола от внешнего api
-type GenderApi struct {
-	Count       int     `json:"count"`
-	Name        string  `json:"name"`
+// Значения пола, которые возвращает внешний api
+const (
+	GenderMale   = "male"
+	GenderFemale = "female"
+)
+
+// Возраст, определенный внешним api
+type AgeResult struct {
+	Name string `json:"name"`
+	// Количество записей, на основе которых сделан прогноз
+	Count int `json:"count"`
+	Age   int `json:"age"`
+	// Страна, по данным которой уточнен прогноз, пусто - без уточнения
+	Country string `json:"country,omitempty"`
+	// Источник, определивший значение, пусто - внешние api
+	Provider string `json:"provider,omitempty"`
+	// Ложь, если api не смог определить возраст (вернул null)
+	Found bool `json:"found"`
+}
+
+// Пол, определенный внешним api
+type GenderResult struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	// GenderMale или GenderFemale
 	Gender      string  `json:"gender"`
 	Probability float64 `json:"probability"`
+	// Страна, по данным которой уточнен прогноз, пусто - без уточнения
+	Country string `json:"country,omitempty"`
+	// Источник, определивший значение, пусто - внешние api
+	Provider string `json:"provider,omitempty"`
+	// Ложь, если api не смог определить пол (вернул null)
+	Found bool `json:"found"`
 }
 
-// Структура получаемой национальности от внешнего api
-type NationApi struct {
-	Count   int       `json:"count"`
-	Name    string    `json:"name"`
+// Национальность, определенная внешним api
+type NationResult struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	// Страны, отсортированные по убыванию вероятности
 	Country []Country `json:"country"`
+	// Источник, определивший значение, пусто - внешние api
+	Provider string `json:"provider,omitempty"`
+	// Ложь, если api не вернул ни одной страны
+	Found bool `json:"found"`
+}
+
+// Страна с наибольшей вероятностью
+func (n NationResult) Top() (Country, bool) {
+	if len(n.Country) == 0 {
+		return Country{}, false
+	}
+	return n.Country[0], true
 }
 
 // Вспомогательная структура - страна с вероятностью
@@ -37,3 +416,51 @@ type Country struct {
 	Country_id  string  `json:"country_id"`
 	Probability float64 `json:"probability"`
 }
+
+// Сохраненные в БД результаты api для имени
+type NameEnrichment struct {
+	// Имя в нижнем регистре
+	Name      string       `json:"name"`
+	Age       AgeResult    `json:"age"`
+	Gender    GenderResult `json:"gender"`
+	Nation    NationResult `json:"nation"`
+	FetchedAt time.Time    `json:"fetched_at"`
+}
+
+// Состояние клиента внешних api
+type APIStatus struct {
+	// Состояние каждого внешнего сервиса
+	Providers []ProviderStatus `json:"providers"`
+	// Статистика кэша, если он включен
+	Cache *CacheStats `json:"cache,omitempty"`
+}
+
+// Состояние предохранителя внешнего сервиса
+type ProviderStatus struct {
+	Name string `json:"name"`
+	// closed - запросы проходят, open - api отключен, half-open - проверяется пробным запросом
+	State string `json:"state"`
+	// Неудачных запросов подряд
+	Failures int `json:"failures"`
+	// Когда будет отправлен пробный запрос, если api отключен
+	RetryAt *time.Time `json:"retry_at,omitempty"`
+	// Квота по заголовкам X-Rate-Limit-*, если api о ней сообщал
+	Quota *QuotaStatus `json:"quota,omitempty"`
+	// Количество записей локального словаря
+	Entries int `json:"entries,omitempty"`
+}
+
+// Квота запросов к внешнему сервису
+type QuotaStatus struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+}
+
+// Статистика кэша результатов api
+type CacheStats struct {
+	Hits     uint64 `json:"hits"`
+	Misses   uint64 `json:"misses"`
+	Size     int    `json:"size"`
+	Capacity int    `json:"capacity"`
+}
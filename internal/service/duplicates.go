@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+	"github.com/pkg/errors"
+)
+
+// Не указан оператор, выполнивший слияние
+var ErrNoMerger = errors.New("merger is required")
+
+const (
+	// Сколько пар с похожими ФИО проверяется при поиске дубликатов
+	duplicateCandidates = 1000
+	// Сколько ближайших по триграммам пользователей рассматривается для каждого
+	duplicateNeighbors = 5
+	// Наибольшее число различающихся букв в нормализованных ФИО у возможных дубликатов
+	maxDuplicateDistance = 2
+)
+
+// Окончания полных и разговорных форм отчества: Иванович и Иваныч, Сергеевич и Сергеич
+// сводятся к одной основе. Более длинные окончания проверяются раньше
+var patronymicEndings = []string{"инична", "ович", "евич", "овна", "евна", "ична", "ыч", "ич"}
+
+// Возможные дубликаты: пары, ФИО которых после нормализации (регистр, ё/е, разговорные
+// формы отчества) различаются не более чем на maxDuplicateDistance букв. Самые близкие - первыми
+func (s *service) FindDuplicates(ctx context.Context) ([]models.DuplicatePair, error) {
+	candidates, err := s.storage.GetDuplicateCandidates(ctx, duplicateNeighbors, duplicateCandidates)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get duplicate candidates")
+	}
+
+	pairs := make([]models.DuplicatePair, 0, len(candidates))
+	for _, pair := range candidates {
+		// Отчества разного пола - точно разные люди
+		firstGender, secondGender := genderByPatronymic(pair.First.Patronymic), genderByPatronymic(pair.Second.Patronymic)
+		if firstGender != "" && secondGender != "" && firstGender != secondGender {
+			continue
+		}
+
+		pair.Distance = editDistance(normalizeName(pair.First.Surname), normalizeName(pair.Second.Surname)) +
+			editDistance(normalizeName(pair.First.Name), normalizeName(pair.Second.Name)) +
+			editDistance(patronymicStem(pair.First.Patronymic), patronymicStem(pair.Second.Patronymic))
+		if pair.Distance <= maxDuplicateDistance {
+			pairs = append(pairs, pair)
+		}
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].Distance < pairs[j].Distance })
+
+	return pairs, nil
+}
+
+// Слияние двух пользователей: сохраняемый получает выбранные поля удаляемого, удаляемый удаляется.
+// Оба пользователя до слияния сохраняются в журнале
+func (s *service) MergeUsers(ctx context.Context, merge models.MergeRequest) error {
+	merge.Merger = strings.TrimSpace(merge.Merger)
+	if merge.Merger == "" {
+		return ErrNoMerger
+	}
+	if merge.KeepID <= 0 || merge.RemoveID <= 0 || merge.KeepID == merge.RemoveID {
+		return errors.Wrapf(ErrInvalidField, "merge needs two different users, got %d and %d", merge.KeepID, merge.RemoveID)
+	}
+
+	take := make([]string, 0, len(merge.Take))
+	for _, field := range merge.Take {
+		switch field {
+		case models.FieldName, models.FieldSurname, models.FieldPatronymic, fieldAge, fieldGender, fieldNation:
+			take = append(take, field)
+		default:
+			return errors.Wrapf(ErrInvalidField, "unknown field to take %q", field)
+		}
+	}
+	merge.Take = take
+
+	if err := s.storage.MergeUsers(ctx, merge); err != nil {
+		return errors.Wrap(err, "failed to merge users")
+	}
+
+	s.logger.Log().Msg(fmt.Sprintf("Пользователь с ID=%v объединен с пользователем ID=%v, взяты поля %v",
+		merge.RemoveID, merge.KeepID, merge.Take))
+
+	return nil
+}
+
+// Журнал слияний, последние - первыми
+func (s *service) ListMerges(ctx context.Context) ([]models.Merge, error) {
+	merges, err := s.storage.ListMerges(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return merges, nil
+}
+
+// Имя или фамилия для сравнения: нижний регистр, ё как е
+func normalizeName(name string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), "ё", "е")
+}
+
+// Основа отчества без окончания полной или разговорной формы
+func patronymicStem(patronymic string) string {
+	patronymic = normalizeName(patronymic)
+	for _, ending := range patronymicEndings {
+		if stem, ok := strings.CutSuffix(patronymic, ending); ok && stem != "" {
+			return stem
+		}
+	}
+	return patronymic
+}
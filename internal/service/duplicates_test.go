@@ -0,0 +1,80 @@
+package service
+
+import "testing"
+
+func TestPatronymicStem(t *testing.T) {
+	tests := []struct {
+		first  string
+		second string
+		same   bool
+	}{
+		{first: "Иванович", second: "Иваныч", same: true},
+		{first: "Сергеевич", second: "Сергеич", same: true},
+		{first: "Ильинична", second: "Ильич", same: true},
+		{first: "Петрович", second: "петрович", same: true},
+		{first: "Алексеевич", second: "Алексеич", same: true},
+		{first: "Фёдорович", second: "Федорович", same: true},
+		{first: " Иванович ", second: "Иванович", same: true},
+		{first: "Иванович", second: "Петрович", same: false},
+		{first: "Сергеевич", second: "Семенович", same: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.first+"/"+tt.second, func(t *testing.T) {
+			first, second := patronymicStem(tt.first), patronymicStem(tt.second)
+			if (first == second) != tt.same {
+				t.Errorf("patronymicStem(%q) = %q, patronymicStem(%q) = %q, want equal %v",
+					tt.first, first, tt.second, second, tt.same)
+			}
+		})
+	}
+}
+
+func TestPatronymicStemKeepsShortNames(t *testing.T) {
+	// Окончание без основы не отрезается
+	tests := []struct {
+		patronymic string
+		want       string
+	}{
+		{patronymic: "Ич", want: "ич"},
+		{patronymic: "Оглы", want: "оглы"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.patronymic, func(t *testing.T) {
+			if got := patronymicStem(tt.patronymic); got != tt.want {
+				t.Errorf("patronymicStem(%q) = %q, want %q", tt.patronymic, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{a: "", b: "", want: 0},
+		{a: "иван", b: "", want: 4},
+		{a: "", b: "иван", want: 4},
+		{a: "иван", b: "иван", want: 0},
+		{a: "иванов", b: "иваноф", want: 1},
+		{a: "иванов", b: "иванова", want: 1},
+		{a: "петров", b: "петро", want: 1},
+		{a: "сидоров", b: "сидрова", want: 2},
+		{a: "kitten", b: "sitting", want: 3},
+		{a: "ёж", b: "еж", want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+			if got := editDistance(tt.a, tt.b); got != tt.want {
+				t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+			if got := editDistance(tt.b, tt.a); got != tt.want {
+				t.Errorf("editDistance(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+			}
+		})
+	}
+}
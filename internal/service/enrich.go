@@ -0,0 +1,518 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Yury132/Golang-Task-4/internal/client/api"
+	"github.com/Yury132/Golang-Task-4/internal/models"
+	"github.com/Yury132/Golang-Task-4/internal/translit"
+	"github.com/pkg/errors"
+)
+
+// Поля пользователя, заполняемые внешними api
+const (
+	fieldAge    = models.FieldAge
+	fieldGender = models.FieldGender
+	fieldNation = models.FieldNation
+)
+
+// Ошибка обогащения - по каждому полю, которое не удалось получить
+type EnrichmentError struct {
+	// Поле -> причина отказа api
+	Fields map[string]error
+}
+
+func (e *EnrichmentError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for field := range e.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		parts = append(parts, fmt.Sprintf("%s: %v", field, e.Fields[field]))
+	}
+
+	return "enrichment failed for " + strings.Join(parts, "; ")
+}
+
+// Позволяет проверять причины через errors.Is, например, api.ErrRateLimited
+func (e *EnrichmentError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Fields))
+	for _, err := range e.Fields {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Результаты обогащения по каждому полю
+type enrichment struct {
+	age       models.AgeResult
+	ageErr    error
+	gender    models.GenderResult
+	genderErr error
+	nation    models.NationResult
+	nationErr error
+	// Откуда взят пол, пусто - от api
+	genderSource string
+	// Пол от api не совпадает с полом по отчеству
+	genderMismatch bool
+}
+
+// Ошибка по неудавшимся полям, nil - если все поля получены
+func (e enrichment) err() *EnrichmentError {
+	fields := make(map[string]error)
+	if e.ageErr != nil {
+		fields[fieldAge] = e.ageErr
+	}
+	if e.genderErr != nil {
+		fields[fieldGender] = e.genderErr
+	}
+	if e.nationErr != nil {
+		fields[fieldNation] = e.nationErr
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return &EnrichmentError{Fields: fields}
+}
+
+// Часть полей не получена из-за исчерпанной квоты api - самое позднее время ее сброса
+func (e enrichment) quotaResetAt() (time.Time, bool) {
+	var (
+		resetAt time.Time
+		found   bool
+	)
+	for _, err := range []error{e.ageErr, e.genderErr, e.nationErr} {
+		var quotaErr *api.QuotaError
+		if errors.As(err, &quotaErr) {
+			found = true
+			if quotaErr.ResetAt.After(resetAt) {
+				resetAt = quotaErr.ResetAt
+			}
+		}
+	}
+	return resetAt, found
+}
+
+// Все поля получены от внешних api. Сохраненные в БД результаты источник не хранят - они тоже от api
+func (e enrichment) fromWeb() bool {
+	for _, provider := range []string{e.age.Provider, e.gender.Provider, e.nation.Provider} {
+		if provider != "" && provider != models.ProviderWeb {
+			return false
+		}
+	}
+	return true
+}
+
+// Все поля не удалось получить
+func (e enrichment) failed() bool {
+	return e.ageErr != nil && e.genderErr != nil && e.nationErr != nil
+}
+
+// Получаем возраст, пол и национальность для множества имен: сначала из БД, остальные - у api
+func (s *service) enrichBatch(ctx context.Context, names []string) map[string]*enrichment {
+	results, missing := s.storedBatch(ctx, names)
+
+	if len(missing) > 0 {
+		fetched := s.fetchEnrichmentBatch(ctx, missing)
+		s.saveEnrichments(ctx, fetched)
+		for name, info := range fetched {
+			results[name] = info
+		}
+	}
+
+	return results
+}
+
+// Сохраненные результаты по именам и имена, для которых их нет
+func (s *service) storedBatch(ctx context.Context, names []string) (map[string]*enrichment, []string) {
+	results := make(map[string]*enrichment, len(names))
+	stored := s.storedEnrichments(ctx, names)
+
+	missing := make([]string, 0, len(names))
+	for _, name := range names {
+		if info, ok := stored[nameKey(name)]; ok {
+			results[name] = info
+		} else {
+			missing = append(missing, name)
+		}
+	}
+
+	return results, missing
+}
+
+// Запрашиваем возраст, пол и национальность для множества имен. Имена на кириллице
+// запрашиваются также в латинском написании, по каждому полю берется более уверенный результат
+func (s *service) fetchEnrichmentBatch(ctx context.Context, names []string) map[string]*enrichment {
+	spellings := make([]string, 0, len(names))
+	latin := make(map[string]string, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		seen[name] = true
+		spellings = append(spellings, name)
+	}
+	for _, name := range names {
+		variant, ok := s.latinSpelling(name)
+		if !ok {
+			continue
+		}
+		latin[name] = variant
+		if !seen[variant] {
+			seen[variant] = true
+			spellings = append(spellings, variant)
+		}
+	}
+
+	fetched := s.fetchSpellings(ctx, spellings)
+	if len(latin) == 0 {
+		return fetched
+	}
+
+	results := make(map[string]*enrichment, len(names))
+	for _, name := range names {
+		info := fetched[name]
+		if variant, ok := latin[name]; ok {
+			info = moreConfident(info, fetched[variant])
+		}
+		results[name] = info
+	}
+
+	return results
+}
+
+// Запрашиваем возраст, пол и национальность для множества написаний имен.
+// Сначала определяем национальность, затем параллельно запрашиваем возраст и пол,
+// уточненные по наиболее вероятной стране имени.
+// Имена отправляются пачками по api.MaxBatchSize, ошибка пачки относится только к ее именам
+func (s *service) fetchSpellings(ctx context.Context, names []string) map[string]*enrichment {
+	results := make(map[string]*enrichment, len(names))
+	for _, name := range names {
+		results[name] = &enrichment{}
+	}
+
+	s.forChunks(ctx, names, func(ctx context.Context, chunk []string) {
+		nations, err := s.userAPI.GetNations(ctx, chunk)
+		if err != nil {
+			err = s.apiError(err, fieldNation)
+		}
+		for i, name := range chunk {
+			if !resolved(err, i) {
+				results[name].nationErr = err
+			} else {
+				results[name].nation = nations[i]
+			}
+		}
+	})
+
+	groups := s.countryGroups(names, results)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		fetchLocalized(ctx, s, groups, fieldAge, s.userAPI.GetAges,
+			func(age models.AgeResult) bool { return age.Found },
+			func(name string, age models.AgeResult, err error) {
+				results[name].age, results[name].ageErr = age, err
+			})
+	}()
+
+	go func() {
+		defer wg.Done()
+		fetchLocalized(ctx, s, groups, fieldGender, s.userAPI.GetGenders,
+			func(gender models.GenderResult) bool { return gender.Found },
+			func(name string, gender models.GenderResult, err error) {
+				results[name].gender, results[name].genderErr = gender, err
+			})
+	}()
+
+	wg.Wait()
+
+	return results
+}
+
+// Имена, сгруппированные по стране, которой уточняется прогноз возраста и пола:
+// наиболее вероятная страна имени, иначе страна по умолчанию. Пустая страна - без уточнения
+func (s *service) countryGroups(names []string, results map[string]*enrichment) map[string][]string {
+	groups := make(map[string][]string)
+	for _, name := range names {
+		var country string
+		if s.cfg.Localize {
+			country = s.cfg.DefaultCountry
+			if info := results[name]; info.nationErr == nil {
+				if top, ok := info.nation.Top(); ok {
+					country = top.Country_id
+				}
+			}
+		}
+		groups[country] = append(groups[country], name)
+	}
+	return groups
+}
+
+// Запрашиваем поле для каждой группы имен с уточнением по ее стране.
+// Если с уточнением значение не определено, имя запрашивается еще раз без уточнения
+func fetchLocalized[T any](ctx context.Context, s *service, groups map[string][]string, field string,
+	fetch func(context.Context, []string, string) ([]T, error), found func(T) bool, set func(string, T, error)) {
+	for country, names := range groups {
+		var retry []string
+		s.forChunks(ctx, names, func(ctx context.Context, chunk []string) {
+			values, err := fetch(ctx, chunk, country)
+			if err != nil {
+				err = s.apiError(err, field)
+			}
+			for i, name := range chunk {
+				switch {
+				case !resolved(err, i):
+					var empty T
+					set(name, empty, err)
+				case country != "" && !found(values[i]):
+					retry = append(retry, name)
+				default:
+					set(name, values[i], nil)
+				}
+			}
+		})
+
+		if len(retry) == 0 {
+			continue
+		}
+		s.forChunks(ctx, retry, func(ctx context.Context, chunk []string) {
+			values, err := fetch(ctx, chunk, "")
+			if err != nil {
+				err = s.apiError(err, field)
+			}
+			for i, name := range chunk {
+				if !resolved(err, i) {
+					var empty T
+					set(name, empty, err)
+				} else {
+					set(name, values[i], nil)
+				}
+			}
+		})
+	}
+}
+
+// Получен ли результат для i-го имени пачки: при частичной ошибке часть имен определили другие источники
+func resolved(err error, i int) bool {
+	if err == nil {
+		return true
+	}
+	var partial *api.PartialError
+	return errors.As(err, &partial) && partial.Resolved[i]
+}
+
+// Последовательно обрабатываем имена пачками, каждая пачка - со своим ограничением по времени
+func (s *service) forChunks(ctx context.Context, names []string, fn func(ctx context.Context, chunk []string)) {
+	for start := 0; start < len(names); start += api.MaxBatchSize {
+		end := start + api.MaxBatchSize
+		if end > len(names) {
+			end = len(names)
+		}
+
+		chunkCtx, cancel := ctx, context.CancelFunc(func() {})
+		if s.cfg.EnrichTimeout > 0 {
+			chunkCtx, cancel = context.WithTimeout(ctx, s.cfg.EnrichTimeout)
+		}
+		fn(chunkCtx, names[start:end])
+		cancel()
+	}
+}
+
+// Латинское написание имени на кириллице, если транслитерация включена
+func (s *service) latinSpelling(name string) (string, bool) {
+	if s.cfg.Translit == translit.None || !translit.HasCyrillic(name) {
+		return "", false
+	}
+	return translit.Transliterate(name, s.cfg.Translit), true
+}
+
+// Сбрасываем закэшированные результаты api для всех написаний имени
+func (s *service) forgetName(name string) {
+	s.userAPI.Forget(name)
+	if variant, ok := s.latinSpelling(name); ok {
+		s.userAPI.Forget(variant)
+	}
+}
+
+// Результаты для двух написаний имени - по каждому полю берем определенный api с большей уверенностью.
+// Ошибка остается, только если поле не получено ни для одного написания
+func moreConfident(original *enrichment, variant *enrichment) *enrichment {
+	result := *original
+
+	if variant.ageErr == nil && (result.ageErr != nil ||
+		(variant.age.Found && (!result.age.Found || variant.age.Count > result.age.Count))) {
+		result.age, result.ageErr = variant.age, nil
+	}
+
+	if variant.genderErr == nil && (result.genderErr != nil ||
+		(variant.gender.Found && (!result.gender.Found || variant.gender.Probability > result.gender.Probability))) {
+		result.gender, result.genderErr = variant.gender, nil
+	}
+
+	if variant.nationErr == nil && (result.nationErr != nil || topProbability(variant.nation) > topProbability(result.nation)) {
+		result.nation, result.nationErr = variant.nation, nil
+	}
+
+	return &result
+}
+
+// Вероятность наиболее вероятной страны, 0 - api страну не определил
+func topProbability(nation models.NationResult) float64 {
+	if country, ok := nation.Top(); ok {
+		return country.Probability
+	}
+	return 0
+}
+
+// Имена в api не зависят от регистра - храним в нижнем
+func nameKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// Сохраненные в БД и еще не устаревшие результаты api, ключ - nameKey.
+// Ошибка БД не мешает обогащению - просто обращаемся к api
+func (s *service) storedEnrichments(ctx context.Context, names []string) map[string]*enrichment {
+	results := make(map[string]*enrichment)
+
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		keys = append(keys, nameKey(name))
+	}
+
+	entries, err := s.storage.GetNameEnrichments(ctx, keys)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to get stored enrichment")
+		return results
+	}
+
+	for _, entry := range entries {
+		if s.cfg.StoredTTL > 0 && time.Since(entry.FetchedAt) > s.cfg.StoredTTL {
+			continue
+		}
+		results[entry.Name] = &enrichment{
+			age:    entry.Age,
+			gender: entry.Gender,
+			nation: entry.Nation,
+		}
+	}
+
+	return results
+}
+
+// Сохраняем в БД результаты api - только если получены все поля и все они от внешних api.
+// Значения из исправлений операторов и словаря меняются вместе со своими данными - их не сохраняем
+func (s *service) saveEnrichments(ctx context.Context, infos map[string]*enrichment) {
+	entries := make([]models.NameEnrichment, 0, len(infos))
+	for name, info := range infos {
+		if info.err() != nil || !info.fromWeb() {
+			continue
+		}
+		entries = append(entries, models.NameEnrichment{
+			Name:      nameKey(name),
+			Age:       info.age,
+			Gender:    info.gender,
+			Nation:    info.nation,
+			FetchedAt: time.Now(),
+		})
+	}
+
+	if len(entries) == 0 {
+		return
+	}
+
+	if err := s.storage.SaveNameEnrichments(ctx, entries); err != nil {
+		s.logger.Error().Err(err).Msg("failed to save enrichment")
+	}
+}
+
+// Переводим результаты api в значения полей пользователя вместе с уверенностью api.
+// Поля, которые не удалось получить, остаются пустыми
+func (s *service) userFields(name string, info enrichment) models.EnrichmentUpdate {
+	var update models.EnrichmentUpdate
+
+	if info.ageErr == nil {
+		if info.age.Found {
+			s.logger.Log().Msg(fmt.Sprintf("Для %v api вернул возраст %v%v", name, info.age.Age, localizedBy(info.age.Country)))
+		} else {
+			s.logger.Log().Msg(fmt.Sprintf("Для %v api не определил возраст", name))
+		}
+		update.Age = info.age.Age
+		update.AgeCount = info.age.Count
+		update.AgeCountry = info.age.Country
+		update.AgeSource = fieldSource(info.age.Provider)
+	}
+
+	if info.genderErr == nil {
+		switch {
+		case info.genderSource == models.SourcePatronymic:
+			s.logger.Log().Msg(fmt.Sprintf("Для %v пол %v определен по отчеству", name, info.gender.Gender))
+		case info.gender.Found:
+			s.logger.Log().Msg(fmt.Sprintf("Для %v api вернул пол %v с вероятностью %v%v", name, info.gender.Gender,
+				info.gender.Probability, localizedBy(info.gender.Country)))
+		default:
+			s.logger.Log().Msg(fmt.Sprintf("Для %v api не определил пол", name))
+		}
+		if info.genderMismatch {
+			s.logger.Warn().Msg(fmt.Sprintf("Для %v пол от api не совпадает с полом по отчеству", name))
+		}
+		// Для БД формируем обозначение пол пользователя, неопределенный пол оставляем пустым
+		switch info.gender.Gender {
+		case models.GenderMale:
+			update.Gender = "м"
+		case models.GenderFemale:
+			update.Gender = "ж"
+		}
+		update.GenderProbability = info.gender.Probability
+		update.GenderCountry = info.gender.Country
+		update.GenderSource = info.genderSource
+		if update.GenderSource == "" {
+			update.GenderSource = fieldSource(info.gender.Provider)
+		}
+		update.GenderMismatch = info.genderMismatch
+	}
+
+	if info.nationErr == nil {
+		s.logger.Log().Msg(fmt.Sprintf("Для %v api вернул следующие коды стран: %v", name, info.nation.Country))
+		// Страны отсортированы по вероятности - берем первую
+		update.Nation = "RU"
+		if country, ok := info.nation.Top(); ok {
+			update.Nation = country.Country_id
+			update.NationProbability = country.Probability
+		}
+		update.Nationalities = info.nation.Country
+		update.NationSource = fieldSource(info.nation.Provider)
+	}
+
+	return update
+}
+
+// Источник значения поля по источнику данных, который его вернул
+func fieldSource(provider string) string {
+	switch provider {
+	case models.ProviderLearned:
+		return models.SourceLearned
+	case models.ProviderDictionary:
+		return models.SourceDictionary
+	default:
+		return models.SourceAPI
+	}
+}
+
+// Пояснение для журнала, по какой стране уточнен прогноз
+func localizedBy(country string) string {
+	if country == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (уточнено для %v)", country)
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+)
+
+// Все накопленные из исправлений операторов значения
+func (s *service) ListNameStats(ctx context.Context) ([]models.NameStat, error) {
+	stats, err := s.storage.ListNameStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// Запоминаем пол и национальность, заданные оператором для имени. Сохраненные результаты api
+// для имени сбрасываем, чтобы при следующем обогащении накопленные значения использовались первыми.
+// Ошибки только логируются - изменения пользователя уже сохранены
+func (s *service) learnName(ctx context.Context, name string, gender string, nation string) {
+	if gender == "" && nation == "" {
+		return
+	}
+
+	key := nameKey(name)
+	if gender != "" {
+		value := models.GenderFemale
+		if gender == "м" {
+			value = models.GenderMale
+		}
+		if err := s.storage.LearnName(ctx, key, fieldGender, value); err != nil {
+			s.logger.Error().Err(err).Msg("failed to learn gender for name")
+		}
+	}
+	if nation != "" {
+		if err := s.storage.LearnName(ctx, key, fieldNation, nation); err != nil {
+			s.logger.Error().Err(err).Msg("failed to learn nation for name")
+		}
+	}
+
+	if _, err := s.InvalidateName(ctx, name); err != nil {
+		s.logger.Error().Err(err).Msg("failed to invalidate name enrichment")
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+)
+
+// Окончания отчеств, по которым однозначно определяется пол
+var (
+	malePatronymicSuffixes   = []string{"ович", "евич", "ич", "оглы", "улы", "уулу"}
+	femalePatronymicSuffixes = []string{"овна", "евна", "ична", "инична", "кызы", "гызы"}
+)
+
+// Пол по окончанию отчества: models.GenderMale, models.GenderFemale или пусто, если определить нельзя
+func genderByPatronymic(patronymic string) string {
+	patronymic = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(patronymic)), "ё", "е")
+	// Тюркские отчества пишутся через пробел или дефис: Алиев оглы, Алиева-кызы
+	if fields := strings.FieldsFunc(patronymic, func(r rune) bool { return r == ' ' || r == '-' }); len(fields) > 0 {
+		patronymic = fields[len(fields)-1]
+	}
+
+	for _, suffix := range femalePatronymicSuffixes {
+		if strings.HasSuffix(patronymic, suffix) {
+			return models.GenderFemale
+		}
+	}
+	for _, suffix := range malePatronymicSuffixes {
+		if strings.HasSuffix(patronymic, suffix) {
+			return models.GenderMale
+		}
+	}
+
+	return ""
+}
+
+// Дополняем результат api полом по отчеству: если api пол не определил или недоступен,
+// используем пол по отчеству, иначе отмечаем расхождение. Результат api для имени не меняется
+func withPatronymic(info enrichment, patronymic string) enrichment {
+	gender := genderByPatronymic(patronymic)
+	if gender == "" {
+		return info
+	}
+
+	if info.genderErr == nil && info.gender.Found {
+		info.genderMismatch = info.gender.Gender != gender
+		return info
+	}
+
+	info.gender = models.GenderResult{Name: info.gender.Name, Gender: gender, Found: true}
+	info.genderErr = nil
+	info.genderSource = models.SourcePatronymic
+	return info
+}
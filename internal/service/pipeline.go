@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+	"github.com/pkg/errors"
+)
+
+// Обогащение очередных пользователей, ожидающих обработки.
+// Имена всей пачки запрашиваются у api вместе, неудачные попытки повторяются с растущей паузой,
+// при исчерпанной квоте обработка откладывается до ее сброса
+func (s *service) EnrichPending(ctx context.Context, limit int) (int, error) {
+	tasks, err := s.storage.ClaimEnrichmentTasks(ctx, limit, s.cfg.TaskLease)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to claim enrichment tasks")
+	}
+	if len(tasks) == 0 {
+		return 0, nil
+	}
+
+	// Уникальные имена пачки
+	names := make([]string, 0, len(tasks))
+	seen := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		if !seen[task.Name] {
+			seen[task.Name] = true
+			names = append(names, task.Name)
+		}
+	}
+
+	infos := s.enrichBatch(ctx, names)
+
+	updates := make([]models.EnrichmentUpdate, 0, len(tasks))
+	for _, task := range tasks {
+		info := withPatronymic(*infos[task.Name], task.Patronymic)
+
+		update := s.userFields(task.Name, info)
+		update.ID = task.ID
+		update.Attempts = task.Attempts + 1
+
+		enrichErr := info.err()
+		resetAt, quotaExhausted := info.quotaResetAt()
+		switch {
+		case enrichErr == nil:
+			update.Status = models.EnrichmentEnriched
+		case quotaExhausted:
+			// Исчерпанная квота - не вина пользователя, попытку не засчитываем
+			update.Status = models.EnrichmentPending
+			update.Attempts = task.Attempts
+			update.NextAt = resetAt
+			update.Error = enrichErr.Error()
+		case update.Attempts >= s.cfg.MaxAttempts:
+			update.Status = models.EnrichmentFailed
+			update.Error = enrichErr.Error()
+		default:
+			update.Status = models.EnrichmentPending
+			update.NextAt = time.Now().Add(s.retryDelay(update.Attempts))
+			update.Error = enrichErr.Error()
+		}
+
+		s.logger.Log().Msg(fmt.Sprintf("Обогащение пользователя с ID=%v: %v, попытка %v", task.ID, update.Status, update.Attempts))
+		updates = append(updates, update)
+	}
+
+	if err = s.storage.UpdateEnrichment(ctx, updates); err != nil {
+		return 0, errors.Wrap(err, "failed to update enrichment")
+	}
+
+	return len(tasks), nil
+}
+
+// Пауза перед повторной попыткой обогащения
+func (s *service) retryDelay(attempts int) time.Duration {
+	delay := s.cfg.RetryDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if s.cfg.RetryMaxDelay > 0 && delay >= s.cfg.RetryMaxDelay {
+			return s.cfg.RetryMaxDelay
+		}
+	}
+	return delay
+}
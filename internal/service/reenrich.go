@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+	"github.com/pkg/errors"
+)
+
+// Сколько пользователей обрабатывается за один проход
+const reenrichPageSize = 100
+
+// Условия повторного обогащения не заданы
+var ErrReenrichNoFilter = errors.New("reenrich filter is empty: set id, status, incomplete or all")
+
+// Повторное обогащение пользователей данными api: берутся сохраненные результаты, пока они не устарели
+// (StoredTTL), для остальных имен данные запрашиваются у api. При DryRun только возвращает изменения,
+// которые были бы сохранены, данные берутся так же, как при настоящем запуске
+func (s *service) ReenrichUsers(ctx context.Context, opts models.ReenrichOptions) (models.ReenrichResult, error) {
+	result := models.ReenrichResult{
+		DryRun: opts.DryRun,
+		Users:  make([]models.UserChanges, 0),
+	}
+
+	if opts.Empty() && !opts.All {
+		return result, ErrReenrichNoFilter
+	}
+
+	var afterID uint64
+	for {
+		users, err := s.storage.GetUsersToReenrich(ctx, opts, afterID, reenrichPageSize)
+		if err != nil {
+			return result, errors.Wrap(err, "failed to get users to reenrich")
+		}
+		if len(users) == 0 {
+			break
+		}
+		afterID = users[len(users)-1].ID
+
+		if err = s.reenrichPage(ctx, users, opts.DryRun, &result); err != nil {
+			return result, err
+		}
+	}
+
+	s.logger.Log().Msg(fmt.Sprintf("Повторное обогащение: проверено %v, изменено %v, пробный запуск: %v",
+		result.Checked, result.Changed, result.DryRun))
+
+	return result, nil
+}
+
+// Повторное обогащение одной страницы пользователей
+func (s *service) reenrichPage(ctx context.Context, users []models.User, dryRun bool, result *models.ReenrichResult) error {
+	names := make([]string, 0, len(users))
+	seen := make(map[string]bool, len(users))
+	for _, user := range users {
+		if !seen[user.Name] {
+			seen[user.Name] = true
+			names = append(names, user.Name)
+		}
+	}
+
+	// Пробный и настоящий запуски берут данные из одного источника, чтобы пробный
+	// показывал именно те изменения, которые сохранит настоящий
+	var infos map[string]*enrichment
+	if dryRun {
+		infos = s.previewEnrichments(ctx, names)
+	} else {
+		infos = s.enrichBatch(ctx, names)
+	}
+
+	updates := make([]models.EnrichmentUpdate, 0, len(users))
+	for _, user := range users {
+		result.Checked++
+		info := withPatronymic(*infos[user.Name], user.Patronymic)
+
+		update := s.userFields(user.Name, info)
+		update.ID = int(user.ID)
+
+		// Поля, заданные оператором или импортированные, данными api не заменяем
+		if !user.APIOwned(fieldAge) {
+			update.Age, update.AgeCount = 0, 0
+		}
+		if !user.APIOwned(fieldGender) {
+			update.Gender, update.GenderProbability = "", 0
+		}
+		if !user.APIOwned(fieldNation) {
+			update.Nation, update.NationProbability, update.Nationalities = "", 0, nil
+		}
+
+		userChanges := models.UserChanges{ID: user.ID}
+		if update.Age != 0 && update.Age != user.Age {
+			userChanges.Changes = append(userChanges.Changes, models.FieldChange{
+				Field: fieldAge, Old: strconv.Itoa(user.Age), New: strconv.Itoa(update.Age),
+			})
+		}
+		if update.Gender != "" && update.Gender != user.Gender {
+			userChanges.Changes = append(userChanges.Changes, models.FieldChange{
+				Field: fieldGender, Old: user.Gender, New: update.Gender,
+			})
+		}
+		if update.Nation != "" && update.Nation != user.Nation {
+			userChanges.Changes = append(userChanges.Changes, models.FieldChange{
+				Field: fieldNation, Old: user.Nation, New: update.Nation,
+			})
+		}
+
+		// Все поля получены - пользователь считается обогащенным,
+		// иначе сохраняем то, что удалось получить, не меняя состояние
+		enrichErr := info.err()
+		if enrichErr == nil {
+			update.Status = models.EnrichmentEnriched
+		} else {
+			userChanges.Error = enrichErr.Error()
+		}
+
+		if len(userChanges.Changes) > 0 {
+			result.Changed++
+		}
+		if len(userChanges.Changes) > 0 || enrichErr != nil {
+			result.Users = append(result.Users, userChanges)
+		}
+		if len(userChanges.Changes) > 0 || (update.Status != "" && update.Status != user.EnrichmentStatus) {
+			updates = append(updates, update)
+		}
+	}
+
+	if dryRun || len(updates) == 0 {
+		return nil
+	}
+
+	if err := s.storage.ApplyReenrichment(ctx, updates); err != nil {
+		return errors.Wrap(err, "failed to apply reenrichment")
+	}
+
+	return nil
+}
+
+// Результаты для пробного запуска - как в enrichBatch, но полученное от api не сохраняется
+func (s *service) previewEnrichments(ctx context.Context, names []string) map[string]*enrichment {
+	results, missing := s.storedBatch(ctx, names)
+	if len(missing) == 0 {
+		return results
+	}
+
+	for name, info := range s.fetchEnrichmentBatch(ctx, missing) {
+		results[name] = info
+	}
+
+	return results
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+	"github.com/pkg/errors"
+)
+
+// Не указан оператор, проверивший пользователя
+var ErrNoReviewer = errors.New("reviewer is required")
+
+// Пользователи, для которых api не определил пол, возраст или национальность
+// либо вероятность пола или национальности ниже порога
+func (s *service) GetReviewQueue(ctx context.Context) ([]models.User, error) {
+	users, err := s.storage.GetReviewQueue(ctx, s.cfg.ReviewThreshold)
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// Порог вероятности, ниже которого результаты api проверяются оператором
+func (s *service) ReviewThreshold() float64 {
+	return s.cfg.ReviewThreshold
+}
+
+// Проверка пользователя оператором. Совпадающие с текущими значения считаются подтвержденными,
+// отличающиеся - исправленными. После проверки пользователь уходит из очереди
+func (s *service) ReviewUser(ctx context.Context, id int, values models.ReviewValues) error {
+	reviewer := strings.TrimSpace(values.Reviewer)
+	if reviewer == "" {
+		return ErrNoReviewer
+	}
+
+	values.Gender = strings.TrimSpace(values.Gender)
+	values.Nation = strings.ToUpper(strings.TrimSpace(values.Nation))
+	if err := validateFields(values.Age, values.Gender, values.Nation); err != nil {
+		return err
+	}
+
+	user, err := s.storage.GetUser(ctx, id)
+	if err != nil {
+		return errors.Wrap(err, "failed to get user to review")
+	}
+
+	review := models.Review{
+		UserID:   id,
+		Reviewer: reviewer,
+		Decisions: []models.ReviewDecision{
+			reviewDecision(fieldAge, strconv.Itoa(user.Age), strconv.Itoa(values.Age)),
+			reviewDecision(fieldGender, user.Gender, values.Gender),
+			reviewDecision(fieldNation, user.Nation, values.Nation),
+		},
+		Age:    values.Age,
+		Gender: values.Gender,
+		Nation: values.Nation,
+	}
+
+	if err = s.storage.SaveReview(ctx, review); err != nil {
+		return errors.Wrap(err, "failed to save review")
+	}
+	s.logger.Log().Msg(fmt.Sprintf("Оператор %v проверил пользователя с ID=%v", reviewer, id))
+
+	// Исправленные значения пригодятся для других пользователей с тем же именем.
+	// Подтверждения не учитываем - иначе значения api закреплялись бы как мнение операторов
+	gender, nation := values.Gender, values.Nation
+	if gender == user.Gender {
+		gender = ""
+	}
+	if nation == user.Nation {
+		nation = ""
+	}
+	s.learnName(ctx, user.Name, gender, nation)
+
+	return nil
+}
+
+// Решение оператора по полю
+func reviewDecision(field string, oldValue string, newValue string) models.ReviewDecision {
+	action := models.ReviewConfirm
+	if oldValue != newValue {
+		action = models.ReviewOverride
+	}
+
+	return models.ReviewDecision{
+		Field:    field,
+		Action:   action,
+		OldValue: oldValue,
+		NewValue: newValue,
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+	"github.com/pkg/errors"
+)
+
+// Сколько найденных пользователей возвращается
+const searchLimit = 50
+
+// Поиск пользователей по части ФИО, в том числе с опечатками.
+// Слова ФИО, совпавшие с запросом, отмечаются в Highlight
+func (s *service) SearchUsers(ctx context.Context, query string) ([]models.SearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, errors.Wrapf(ErrInvalidField, "search query must contain letters or digits, got %q", query)
+	}
+
+	// Каждое слово запроса ищется как начало слова ФИО
+	prefixes := make([]string, 0, len(terms))
+	for _, term := range terms {
+		prefixes = append(prefixes, term+":*")
+	}
+
+	results, err := s.storage.SearchUsers(ctx, strings.Join(prefixes, " & "), strings.Join(terms, " "), searchLimit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to search users")
+	}
+
+	for i := range results {
+		user := results[i].User
+		results[i].Highlight = highlight([]string{user.Surname, user.Name, user.Patronymic}, terms)
+	}
+
+	return results, nil
+}
+
+// Слова запроса в нижнем регистре - только буквы и цифры, поэтому их можно подставлять в tsquery
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+}
+
+// Части ФИО через пробел с отметкой слов, которые начинаются с одного из слов запроса
+// или отличаются от него не более чем на одну букву на каждые четыре
+func highlight(words []string, terms []string) []models.Highlight {
+	parts := make([]models.Highlight, 0, 2*len(words))
+	for i, word := range words {
+		if i > 0 {
+			parts = append(parts, models.Highlight{Text: " "})
+		}
+		parts = append(parts, models.Highlight{Text: word, Match: matchesTerm(word, terms)})
+	}
+	return parts
+}
+
+func matchesTerm(word string, terms []string) bool {
+	word = strings.ToLower(word)
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+		if maxTypos := len([]rune(term)) / 4; maxTypos > 0 && editDistance(word, term) <= maxTypos {
+			return true
+		}
+	}
+	return false
+}
+
+// Расстояние Левенштейна по буквам: сколько вставок, удалений и замен превращают a в b
+func editDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
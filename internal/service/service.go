@@ -2,206 +2,298 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/Yury132/Golang-Task-4/internal/client/api"
 	"github.com/Yury132/Golang-Task-4/internal/models"
+	"github.com/Yury132/Golang-Task-4/internal/storage"
+	"github.com/Yury132/Golang-Task-4/internal/translit"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 )
 
+// Размер страницы списка пользователей, если он не задан в настройках
+const defaultPageSize = 50
+
+// Пользователь с указанным ID не найден
+var ErrUserNotFound = storage.ErrUserNotFound
+
+// Пользователь с таким же ФИО уже есть
+var ErrDuplicate = storage.ErrDuplicate
+
+// Курсор страницы поврежден или получен для другой сортировки
+var ErrInvalidCursor = storage.ErrInvalidCursor
+
 type Service interface {
-	// Получение всех пользователей БД
-	GetUsersList(ctx context.Context) ([]models.User, error)
-	// Получение определенных пользователей по возрасту
-	GetUsersListAge(ctx context.Context, userAgeMin int, userAgeMax int) ([]models.User, error)
-	// Получение определенных пользователей по полу
-	GetUsersListGender(ctx context.Context, gender string) ([]models.User, error)
-	// Получение определенных пользователей по национальности
-	GetUsersListNation(ctx context.Context, userNation string) ([]models.User, error)
-	// Добавление нового пользователя, если точно такой же уже не существует в БД
+	// Страница пользователей БД, подходящих под фильтр
+	GetUsersList(ctx context.Context, filter models.UserFilter, page models.PageRequest) (models.UserPage, error)
+	// Поиск пользователей по части ФИО, в том числе с опечатками
+	SearchUsers(ctx context.Context, query string) ([]models.SearchResult, error)
+	// Добавление нового пользователя, ErrDuplicate - пользователь с таким ФИО уже есть
 	HandleUser(ctx context.Context, name string, surname string, patronymic string) error
+	// Массовое добавление пользователей с пакетными запросами к api
+	ImportUsers(ctx context.Context, users []models.User) (models.ImportResult, error)
 	// Удаление пользователя
 	DeleteUser(ctx context.Context, id int) error
 	// Получение конкретного пользователя по ID
 	GetUser(ctx context.Context, id int) (models.User, error)
-	// Обновление данных конкретного пользователя по ID
-	EditUser(ctx context.Context, id int, getUserName string, getUserSurname string, getUserPatronymic string) error
+	// Обновление данных конкретного пользователя по ID, пустые значения не меняют поле
+	EditUser(ctx context.Context, id int, edit models.UserEdit) error
+	// Состояние клиента внешних api
+	GetAPIStatus() models.APIStatus
+	// Удаление сохраненных результатов api для имени
+	InvalidateName(ctx context.Context, name string) (bool, error)
+	// Обогащение очередных пользователей, ожидающих обработки, возвращает их количество
+	EnrichPending(ctx context.Context, limit int) (int, error)
+	// Повторное обогащение пользователей свежими данными api
+	ReenrichUsers(ctx context.Context, opts models.ReenrichOptions) (models.ReenrichResult, error)
+	// Пользователи, результаты api для которых нужно проверить
+	GetReviewQueue(ctx context.Context) ([]models.User, error)
+	// Проверка пользователя оператором: подтверждение или исправление полей
+	ReviewUser(ctx context.Context, id int, values models.ReviewValues) error
+	// Порог вероятности, ниже которого результаты api проверяются оператором
+	ReviewThreshold() float64
+	// Пол и национальность для имен, накопленные из исправлений операторов
+	ListNameStats(ctx context.Context) ([]models.NameStat, error)
+	// Возможные дубликаты - пары пользователей с почти совпадающими ФИО
+	FindDuplicates(ctx context.Context) ([]models.DuplicatePair, error)
+	// Слияние двух пользователей в одного с выбором значения каждого поля
+	MergeUsers(ctx context.Context, merge models.MergeRequest) error
+	// Журнал слияний
+	ListMerges(ctx context.Context) ([]models.Merge, error)
 }
 
 type UserAPI interface {
-	// Получаем данные о возрасте
-	GetAge(name string) ([]byte, error)
-	// Получаем данные о поле
-	GetGender(name string) ([]byte, error)
-	// Получаем данные о национальности
-	GetNation(name string) ([]byte, error)
+	// Получаем данные о возрасте сразу для нескольких имен,
+	// country - код страны для уточнения прогноза, пусто - без уточнения
+	GetAges(ctx context.Context, names []string, country string) ([]models.AgeResult, error)
+	// Получаем данные о поле сразу для нескольких имен,
+	// country - код страны для уточнения прогноза, пусто - без уточнения
+	GetGenders(ctx context.Context, names []string, country string) ([]models.GenderResult, error)
+	// Получаем данные о национальности сразу для нескольких имен
+	GetNations(ctx context.Context, names []string) ([]models.NationResult, error)
+	// Текущее состояние клиента
+	Status() models.APIStatus
+	// Сбрасываем закэшированные результаты для имени
+	Forget(name string)
 }
 
 type Storage interface {
-	// Получение всех пользователей БД
-	GetUsersList(ctx context.Context) ([]models.User, error)
-	// Получение определенных пользователей по возрасту
-	GetUsersListAge(ctx context.Context, ageMin int, ageMax int) ([]models.User, error)
-	// Получение определенных пользователей по полу
-	GetUsersListGender(ctx context.Context, gender string) ([]models.User, error)
-	// Получение определенных пользователей по национальности
-	GetUsersListNation(ctx context.Context, nation string) ([]models.User, error)
-	// Проверка на существование пользователя
-	CheckUser(ctx context.Context, name string, surname string, patronymic string) (bool, error)
-	// Создание нового пользователя
-	CreateUser(ctx context.Context, name string, surname string, patronymic string, age int, gender string, nation string) error
+	// Страница пользователей БД, подходящих под все условия фильтра
+	GetUsersList(ctx context.Context, filter models.UserFilter, page models.PageRequest) (models.UserPage, error)
+	// Поиск пользователей по ФИО: tsQuery - слова с префиксным поиском, text - строка для триграммного сравнения
+	SearchUsers(ctx context.Context, tsQuery string, text string, limit int) ([]models.SearchResult, error)
+	// Создание нового пользователя, ErrDuplicate - пользователь с таким ФИО уже есть
+	CreateUser(ctx context.Context, name string, surname string, patronymic string) (int, error)
+	// Создание множества пользователей, уже существующие пропускаются
+	CreateUsers(ctx context.Context, users []models.User) (int, error)
 	// Удаление пользователя
 	DeleteUser(ctx context.Context, id int) error
 	// Получение конкретного пользователя по ID
 	GetUser(ctx context.Context, id int) (models.User, error)
-	// Обновление данных конкретного пользователя по ID
-	EditUser(ctx context.Context, id int, getUserName string, getUserSurname string, getUserPatronymic string) error
+	// Обновление данных конкретного пользователя по ID, пустые значения не меняют поле
+	EditUser(ctx context.Context, id int, edit models.UserEdit) error
+	// Сохраненные результаты api для имен
+	GetNameEnrichments(ctx context.Context, names []string) ([]models.NameEnrichment, error)
+	// Сохранение результатов api
+	SaveNameEnrichments(ctx context.Context, entries []models.NameEnrichment) error
+	// Удаление сохраненных результатов api для имени
+	DeleteNameEnrichment(ctx context.Context, name string) (bool, error)
+	// Захват очередных пользователей, ожидающих обогащения
+	ClaimEnrichmentTasks(ctx context.Context, limit int, lease time.Duration) ([]models.EnrichmentTask, error)
+	// Сохранение результатов обогащения
+	UpdateEnrichment(ctx context.Context, updates []models.EnrichmentUpdate) error
+	// Пользователи для повторного обогащения - очередная страница после afterID
+	GetUsersToReenrich(ctx context.Context, opts models.ReenrichOptions, afterID uint64, limit int) ([]models.User, error)
+	// Перезапись обогащенных полей после повторного обогащения
+	ApplyReenrichment(ctx context.Context, updates []models.EnrichmentUpdate) error
+	// Пользователи с неуверенными результатами api, еще не проверенные оператором
+	GetReviewQueue(ctx context.Context, threshold float64) ([]models.User, error)
+	// Сохранение проверки пользователя оператором
+	SaveReview(ctx context.Context, review models.Review) error
+	// Учитываем значение поля, заданное оператором для имени
+	LearnName(ctx context.Context, name string, field string, value string) error
+	// Накопленные из исправлений операторов значения для имен
+	GetNameStats(ctx context.Context, names []string) ([]models.NameStat, error)
+	// Все накопленные значения
+	ListNameStats(ctx context.Context) ([]models.NameStat, error)
+	// Пары пользователей с похожими по триграммам ФИО, самые похожие - первыми
+	GetDuplicateCandidates(ctx context.Context, neighbors int, limit int) ([]models.DuplicatePair, error)
+	// Слияние двух пользователей в одного с записью в журнал
+	MergeUsers(ctx context.Context, merge models.MergeRequest) error
+	// Журнал слияний
+	ListMerges(ctx context.Context) ([]models.Merge, error)
+}
+
+// Настройки сервиса
+type Config struct {
+	// Общее ограничение времени на обогащение данных пользователя
+	EnrichTimeout time.Duration
+	// Через сколько сохраненные в БД результаты api считаются устаревшими, 0 - никогда
+	StoredTTL time.Duration
+	// На сколько захватывается пользователь для обогащения
+	TaskLease time.Duration
+	// Сколько раз пытаться обогатить пользователя, прежде чем признать неудачу
+	MaxAttempts int
+	// Пауза перед повторной попыткой, растет вдвое с каждой попыткой до RetryMaxDelay
+	RetryDelay    time.Duration
+	RetryMaxDelay time.Duration
+	// Пол и национальность с меньшей вероятностью проверяются оператором
+	ReviewThreshold float64
+	// Система транслитерации имен на кириллице для запроса к api, None - не транслитерировать
+	Translit translit.Scheme
+	// Уточнять возраст и пол по наиболее вероятной стране имени
+	Localize bool
+	// Страна для уточнения, если api не определил национальность, пусто - не уточнять
+	DefaultCountry string
+	// Размер страницы списка пользователей по умолчанию и наибольший допустимый
+	PageSize    int
+	MaxPageSize int
 }
 
 type service struct {
 	logger  zerolog.Logger
 	userAPI UserAPI
 	storage Storage
+	cfg     Config
 }
 
-// Все пользователи в БД
-func (s *service) GetUsersList(ctx context.Context) ([]models.User, error) {
-	users, err := s.storage.GetUsersList(ctx)
-	if err != nil {
-		return nil, err
+// Страница пользователей в БД, подходящих под фильтр
+func (s *service) GetUsersList(ctx context.Context, filter models.UserFilter, page models.PageRequest) (models.UserPage, error) {
+	filter = normalizeFilter(filter)
+	if err := validateFilter(filter); err != nil {
+		return models.UserPage{}, err
 	}
 
-	return users, nil
-}
-
-// Получение определенных пользователей по возрасту
-func (s *service) GetUsersListAge(ctx context.Context, userAgeMin int, userAgeMax int) ([]models.User, error) {
-	users, err := s.storage.GetUsersListAge(ctx, userAgeMin, userAgeMax)
-	if err != nil {
-		return nil, err
+	page = s.normalizePage(page)
+	if err := validatePage(page); err != nil {
+		return models.UserPage{}, err
 	}
 
-	return users, nil
-}
-
-// Получение определенных пользователей по полу
-func (s *service) GetUsersListGender(ctx context.Context, gender string) ([]models.User, error) {
-	users, err := s.storage.GetUsersListGender(ctx, gender)
+	result, err := s.storage.GetUsersList(ctx, filter, page)
 	if err != nil {
-		return nil, err
+		return models.UserPage{}, err
 	}
 
-	return users, nil
+	return result, nil
 }
 
-// Получение определенных пользователей по национальности
-func (s *service) GetUsersListNation(ctx context.Context, userNation string) ([]models.User, error) {
-	users, err := s.storage.GetUsersListNation(ctx, userNation)
-	if err != nil {
-		return nil, err
+// Сортировка по ID и размер страницы по умолчанию, слишком большая страница уменьшается
+func (s *service) normalizePage(page models.PageRequest) models.PageRequest {
+	if page.Sort == "" {
+		page.Sort = models.SortID
 	}
-
-	return users, nil
+	if page.Limit == 0 {
+		page.Limit = s.cfg.PageSize
+		if page.Limit <= 0 {
+			page.Limit = defaultPageSize
+		}
+	}
+	if s.cfg.MaxPageSize > 0 && page.Limit > s.cfg.MaxPageSize {
+		page.Limit = s.cfg.MaxPageSize
+	}
+	return page
 }
 
-// Добавление нового пользователя, если точно такой же уже не существует в БД
+// Добавление нового пользователя, если пользователя с таким же ФИО (без учета регистра) еще нет.
+// Возраст, пол и национальность заполняются в фоне - см. EnrichPending, так что для дубликата
+// api не запрашиваются
 func (s *service) HandleUser(ctx context.Context, name string, surname string, patronymic string) error {
+	name = strings.TrimSpace(name)
+	surname = strings.TrimSpace(surname)
+	patronymic = strings.TrimSpace(patronymic)
 
-	// Используем api для получения возраста
-	dataBytesAge, err := s.userAPI.GetAge(name)
-	if err != nil {
-		return errors.Wrap(err, "failed to get age from api")
-	}
-
-	// Переводим байты в структуру
-	var infoAge models.AgeApi
-	if err = json.Unmarshal(dataBytesAge, &infoAge); err != nil {
-		return errors.Wrap(err, "failed to unmarshal age from api")
+	id, err := s.createUser(ctx, name, surname, patronymic)
+	if errors.Is(err, ErrDuplicate) {
+		s.logger.Log().Msg("ФИО нового пользователя совпадает с уже существующим")
+		return err
 	}
-	s.logger.Log().Msg(fmt.Sprintf("Для %v api вернул возраст %v", name, infoAge.Age))
-
-	// Используем api для получения пола
-	dataBytesGender, err := s.userAPI.GetGender(name)
 	if err != nil {
-		return errors.Wrap(err, "failed to get gender from api")
+		return errors.Wrap(err, "failed to create user")
 	}
+	s.logger.Log().Msg(fmt.Sprintf("Пользователь с ID=%v добавлен и ожидает обогащения", id))
 
-	// Переводим байты в структуру
-	var infoGender models.GenderApi
-	if err = json.Unmarshal(dataBytesGender, &infoGender); err != nil {
-		return errors.Wrap(err, "failed to unmarshal gender from api")
+	return nil
+}
+
+// Массовое добавление пользователей. Обогащение выполняется в фоне пачками,
+// так что каждое имя запрашивается у api один раз
+func (s *service) ImportUsers(ctx context.Context, users []models.User) (models.ImportResult, error) {
+	result := models.ImportResult{Total: len(users)}
+	if len(users) == 0 {
+		return result, nil
 	}
-	s.logger.Log().Msg(fmt.Sprintf("Для %v api вернул пол %v", name, infoGender.Gender))
 
-	// Для БД формируем обозначение пол пользователя
-	var getGender string
-	if infoGender.Gender == "male" {
-		getGender = "м"
-	} else {
-		getGender = "ж"
+	// Переданные возраст, пол и национальность должны быть допустимыми - api их уже не изменит
+	for i := range users {
+		users[i].Nation = strings.ToUpper(strings.TrimSpace(users[i].Nation))
+		users[i].Gender = strings.TrimSpace(users[i].Gender)
+		if err := validateImported(users[i]); err != nil {
+			return result, errors.Wrapf(err, "user %d", i+1)
+		}
 	}
 
-	// Используем api для получения национальности
-	dataBytesNation, err := s.userAPI.GetNation(name)
+	created, err := s.storage.CreateUsers(ctx, users)
 	if err != nil {
-		return errors.Wrap(err, "failed to get nation from api")
+		return result, errors.Wrap(err, "failed to create users")
 	}
+	result.Created = created
+	result.Skipped = len(users) - created
 
-	// Переводим байты в структуру
-	var infoNation models.NationApi
-	if err = json.Unmarshal(dataBytesNation, &infoNation); err != nil {
-		return errors.Wrap(err, "failed to unmarshal nation from api")
-	}
-	s.logger.Log().Msg(fmt.Sprintf("Для %v api вернул следующие коды стран: %v", name, infoNation.Country))
+	s.logger.Log().Msg(fmt.Sprintf("Импорт пользователей: всего %v, добавлено %v, пропущено %v",
+		result.Total, result.Created, result.Skipped))
 
-	// Ищем наибольшую вероятность - какую национальность имеет пользователь
-	probability := 0.0
-	countryCode := "RU"
-	// Проходимся в цикле
-	for _, value := range infoNation.Country {
-		if value.Probability > probability {
-			probability = value.Probability
-			countryCode = value.Country_id
-		}
-	}
+	return result, nil
+}
 
-	// Проверяем на полное совпадение по ФИО в БД
-	ok, err := s.checkUser(ctx, name, surname, patronymic)
-	if err != nil {
-		return errors.Wrap(err, "failed to check user")
+// Проверка заполненных полей, переданных при импорте или изменении, незаполненные поля получим у api
+func validateImported(user models.User) error {
+	if user.Age != 0 {
+		if err := validateAge(user.Age); err != nil {
+			return err
+		}
 	}
-
-	if ok {
-		s.logger.Log().Msg("ФИО нового пользователя полностью совпадает с уже существующим")
-	} else {
-		// Создаем
-		if err = s.createUser(ctx, name, surname, patronymic, infoAge.Age, getGender, countryCode); err != nil { // infoAge.Age, getGender
-			return errors.Wrap(err, "failed to create user")
+	if user.Gender != "" {
+		if err := validateGender(user.Gender); err != nil {
+			return err
 		}
 	}
-
+	if user.Nation != "" {
+		return validateNation(user.Nation)
+	}
 	return nil
 }
 
-// Проверка на существование пользователя
-func (s *service) checkUser(ctx context.Context, name string, surname string, patronymic string) (bool, error) {
-	check, err := s.storage.CheckUser(ctx, name, surname, patronymic)
-	if err != nil {
-		return false, err
+// Логируем причину отказа внешнего api и оборачиваем ошибку
+func (s *service) apiError(err error, field string) error {
+	switch {
+	case errors.Is(err, api.ErrQuotaExhausted):
+		s.logger.Warn().Err(err).Msgf("Квота api исчерпана, поле %v будет получено после ее сброса", field)
+	case errors.Is(err, api.ErrRateLimited):
+		s.logger.Warn().Err(err).Msgf("Превышен лимит запросов к api при получении поля %v", field)
+	case errors.Is(err, api.ErrCircuitOpen):
+		s.logger.Warn().Err(err).Msgf("Api временно отключен после серии ошибок, поле %v не получено", field)
+	case errors.Is(err, api.ErrUnavailable):
+		s.logger.Warn().Err(err).Msgf("Api недоступен при получении поля %v", field)
+	case errors.Is(err, api.ErrBadRequest):
+		s.logger.Error().Err(err).Msgf("Api отклонил запрос при получении поля %v", field)
+	case errors.Is(err, api.ErrInvalidResponse):
+		s.logger.Error().Err(err).Msgf("Api вернул некорректный ответ при получении поля %v", field)
 	}
 
-	return check, nil
+	return errors.Wrapf(err, "failed to get %s from api", field)
 }
 
 // Создание нового пользователя
-func (s *service) createUser(ctx context.Context, name string, surname string, patronymic string, age int, gender string, nation string) error {
-	err := s.storage.CreateUser(ctx, name, surname, patronymic, age, gender, nation)
+func (s *service) createUser(ctx context.Context, name string, surname string, patronymic string) (int, error) {
+	id, err := s.storage.CreateUser(ctx, name, surname, patronymic)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	return id, nil
 }
 
 // Удаление пользователя
@@ -226,20 +318,70 @@ func (s *service) GetUser(ctx context.Context, id int) (models.User, error) {
 	return user, nil
 }
 
-// Обновление данных конкретного пользователя по ID
-func (s *service) EditUser(ctx context.Context, id int, getUserName string, getUserSurname string, getUserPatronymic string) error {
-	err := s.storage.EditUser(ctx, id, getUserName, getUserSurname, getUserPatronymic)
+// Обновление данных конкретного пользователя по ID. Возраст, пол и национальность
+// проверяются и, если изменились, считаются заданными вручную
+func (s *service) EditUser(ctx context.Context, id int, edit models.UserEdit) error {
+	edit.Name = strings.TrimSpace(edit.Name)
+	edit.Surname = strings.TrimSpace(edit.Surname)
+	edit.Patronymic = strings.TrimSpace(edit.Patronymic)
+	edit.Gender = strings.TrimSpace(edit.Gender)
+	edit.Nation = strings.ToUpper(strings.TrimSpace(edit.Nation))
+	edit.Editor = strings.TrimSpace(edit.Editor)
+
+	user, err := s.storage.GetUser(ctx, id)
 	if err != nil {
+		return errors.Wrap(err, "failed to get user to edit")
+	}
+
+	// Неизмененные значения не трогаем, чтобы не закреплять за оператором данные api
+	if edit.Age == user.Age {
+		edit.Age = 0
+	}
+	if edit.Gender == user.Gender {
+		edit.Gender = ""
+	}
+	if edit.Nation == user.Nation {
+		edit.Nation = ""
+	}
+	if err = validateImported(models.User{Age: edit.Age, Gender: edit.Gender, Nation: edit.Nation}); err != nil {
 		return err
 	}
 
+	if err = s.storage.EditUser(ctx, id, edit); err != nil {
+		return errors.Wrap(err, "failed to edit user")
+	}
+
+	// Исправленные значения пригодятся для других пользователей с тем же именем
+	name := user.Name
+	if edit.Name != "" {
+		name = edit.Name
+	}
+	s.learnName(ctx, name, edit.Gender, edit.Nation)
+
 	return nil
 }
 
-func New(logger zerolog.Logger, userAPI UserAPI, storage Storage) Service {
+// Состояние клиента внешних api
+func (s *service) GetAPIStatus() models.APIStatus {
+	return s.userAPI.Status()
+}
+
+// Удаление сохраненных результатов api для имени - при следующем обращении они будут запрошены заново
+func (s *service) InvalidateName(ctx context.Context, name string) (bool, error) {
+	deleted, err := s.storage.DeleteNameEnrichment(ctx, nameKey(name))
+	if err != nil {
+		return false, err
+	}
+	s.forgetName(name)
+
+	return deleted, nil
+}
+
+func New(logger zerolog.Logger, userAPI UserAPI, storage Storage, cfg Config) Service {
 	return &service{
 		logger:  logger,
 		userAPI: userAPI,
 		storage: storage,
+		cfg:     cfg,
 	}
 }
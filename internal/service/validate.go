@@ -0,0 +1,111 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+	"github.com/pkg/errors"
+)
+
+// Недопустимое значение поля пользователя
+var ErrInvalidField = errors.New("invalid field value")
+
+// Допустимые границы возраста
+const (
+	minAge = 1
+	maxAge = 150
+)
+
+// Проверка значений возраста, пола и национальности, заданных вручную
+func validateFields(age int, gender string, nation string) error {
+	if err := validateAge(age); err != nil {
+		return err
+	}
+	if err := validateGender(gender); err != nil {
+		return err
+	}
+	return validateNation(nation)
+}
+
+// Возраст в допустимых границах
+func validateAge(age int) error {
+	if age < minAge || age > maxAge {
+		return errors.Wrapf(ErrInvalidField, "age must be between %d and %d, got %d", minAge, maxAge, age)
+	}
+	return nil
+}
+
+// Пол в обозначении БД: "м" или "ж"
+func validateGender(gender string) error {
+	if gender != "м" && gender != "ж" {
+		return errors.Wrapf(ErrInvalidField, "gender must be \"м\" or \"ж\", got %q", gender)
+	}
+	return nil
+}
+
+// Код страны ISO 3166-1 alpha-2 в верхнем регистре
+func validateNation(nation string) error {
+	if !models.IsCountryCode(nation) {
+		return errors.Wrapf(ErrInvalidField, "nation must be an ISO 3166-1 alpha-2 country code, got %q", nation)
+	}
+	return nil
+}
+
+// Убираем лишние пробелы, коды стран - в верхнем регистре, пустые коды пропускаем
+func normalizeFilter(filter models.UserFilter) models.UserFilter {
+	filter.Gender = strings.TrimSpace(filter.Gender)
+	filter.Name = strings.TrimSpace(filter.Name)
+
+	nations := make([]string, 0, len(filter.Nations))
+	for _, nation := range filter.Nations {
+		if nation = strings.ToUpper(strings.TrimSpace(nation)); nation != "" {
+			nations = append(nations, nation)
+		}
+	}
+	filter.Nations = nations
+
+	return filter
+}
+
+// Заданные условия фильтра допустимы и не противоречат друг другу
+func validateFilter(filter models.UserFilter) error {
+	if filter.AgeMin < 0 || filter.AgeMax < 0 {
+		return errors.Wrapf(ErrInvalidField, "age range must not be negative, got %d-%d", filter.AgeMin, filter.AgeMax)
+	}
+	if filter.AgeMax > 0 && filter.AgeMin > filter.AgeMax {
+		return errors.Wrapf(ErrInvalidField, "min age %d is greater than max age %d", filter.AgeMin, filter.AgeMax)
+	}
+	if filter.Gender != "" {
+		if err := validateGender(filter.Gender); err != nil {
+			return err
+		}
+	}
+	for _, nation := range filter.Nations {
+		if err := validateNation(nation); err != nil {
+			return err
+		}
+	}
+	if filter.MinNationProbability < 0 || filter.MinNationProbability > 1 {
+		return errors.Wrapf(ErrInvalidField, "nation probability must be between 0 and 1, got %v", filter.MinNationProbability)
+	}
+	if !filter.CreatedFrom.IsZero() && !filter.CreatedTo.IsZero() && !filter.CreatedFrom.Before(filter.CreatedTo) {
+		return errors.Wrapf(ErrInvalidField, "created range is empty: from %v to %v", filter.CreatedFrom, filter.CreatedTo)
+	}
+	return nil
+}
+
+// Поле сортировки известно, размер страницы положительный, задан не более чем один курсор
+func validatePage(page models.PageRequest) error {
+	switch page.Sort {
+	case models.SortID, models.SortSurname, models.SortAge, models.SortNation:
+	default:
+		return errors.Wrapf(ErrInvalidField, "sort must be id, surname, age or nation, got %q", page.Sort)
+	}
+	if page.Limit <= 0 {
+		return errors.Wrapf(ErrInvalidField, "page size must be positive, got %d", page.Limit)
+	}
+	if page.After != "" && page.Before != "" {
+		return errors.Wrap(ErrInvalidField, "only one of after and before cursors can be set")
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+)
+
+// Курсор страницы поврежден или получен для другой сортировки
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// Выражение для сортировки по полю и тип, к которому приводится значение курсора
+type sortColumn struct {
+	expr string
+	cast string
+}
+
+// Поля сортировки списка пользователей. Незаполненные значения сортируются как пустые.
+// Для каждого выражения есть индекс (expr, id), см. миграцию 0015_users_sort_indexes.sql
+var sortColumns = map[string]sortColumn{
+	models.SortID:      {expr: "id", cast: "integer"},
+	models.SortSurname: {expr: "surname", cast: "text"},
+	models.SortAge:     {expr: "COALESCE(age, 0)", cast: "integer"},
+	models.SortNation:  {expr: "COALESCE(nation, '')", cast: "text"},
+}
+
+// Позиция в списке: поле сортировки, его значение и ID пользователя для однозначного порядка
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    uint64 `json:"id"`
+}
+
+// Курсор, указывающий на пользователя, для передачи в адресе страницы
+func encodeCursor(sort string, user models.User) string {
+	cur := cursor{Sort: sort, ID: user.ID}
+	switch sort {
+	case models.SortSurname:
+		cur.Value = user.Surname
+	case models.SortAge:
+		cur.Value = strconv.Itoa(user.Age)
+	case models.SortNation:
+		cur.Value = user.Nation
+	default:
+		cur.Value = strconv.FormatUint(user.ID, 10)
+	}
+
+	data, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Разбираем курсор и проверяем, что он получен для той же сортировки
+func decodeCursor(value string, sort string) (cursor, error) {
+	var cur cursor
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cur, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	if err = json.Unmarshal(data, &cur); err != nil {
+		return cur, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	if cur.Sort != sort {
+		return cur, fmt.Errorf("%w: cursor is for sort %q, not %q", ErrInvalidCursor, cur.Sort, sort)
+	}
+	if sortColumns[sort].cast == "integer" {
+		if _, err = strconv.Atoi(cur.Value); err != nil {
+			return cur, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+		}
+	}
+
+	return cur, nil
+}
+
+// Страница из выбранных пользователей: запрошено на одного больше лимита, чтобы узнать, есть ли продолжение.
+// Идя назад, пользователи выбраны в обратном порядке - разворачиваем их
+func cursorPage(users []models.User, page models.PageRequest) models.UserPage {
+	result := models.UserPage{Users: make([]models.User, 0)}
+	backward := page.Before != ""
+
+	more := len(users) > page.Limit
+	if more {
+		users = users[:page.Limit]
+	}
+	if backward {
+		for i, j := 0, len(users)-1; i < j; i, j = i+1, j-1 {
+			users[i], users[j] = users[j], users[i]
+		}
+	}
+	if len(users) == 0 {
+		return result
+	}
+	result.Users = users
+
+	first, last := users[0], users[len(users)-1]
+	// Идя назад, пришли со следующей страницы, идя вперед по курсору - с предыдущей
+	if more || backward {
+		result.Next = encodeCursor(page.Sort, last)
+	}
+	if (more && backward) || page.After != "" {
+		result.Prev = encodeCursor(page.Sort, first)
+	}
+
+	return result
+}
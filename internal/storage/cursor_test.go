@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	user := models.User{ID: 42, Surname: "Иванов", Age: 30, Nation: "RU"}
+
+	tests := []struct {
+		sort      string
+		wantValue string
+	}{
+		{sort: models.SortID, wantValue: "42"},
+		{sort: models.SortSurname, wantValue: "Иванов"},
+		{sort: models.SortAge, wantValue: "30"},
+		{sort: models.SortNation, wantValue: "RU"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			cur, err := decodeCursor(encodeCursor(tt.sort, user), tt.sort)
+			if err != nil {
+				t.Fatalf("decodeCursor() error = %v", err)
+			}
+			if cur.Sort != tt.sort || cur.Value != tt.wantValue || cur.ID != user.ID {
+				t.Errorf("decodeCursor() = %+v, want sort %q value %q id %d", cur, tt.sort, tt.wantValue, user.ID)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name  string
+		value string
+		sort  string
+	}{
+		{name: "not base64", value: "!!!", sort: models.SortID},
+		{name: "not json", value: encode("id=1"), sort: models.SortID},
+		{name: "other sort", value: encodeCursor(models.SortSurname, models.User{ID: 1, Surname: "Петров"}), sort: models.SortAge},
+		{name: "not a number for integer sort", value: encode(`{"s":"age","v":"old","id":1}`), sort: models.SortAge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.value, tt.sort); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("decodeCursor() error = %v, want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestCursorPage(t *testing.T) {
+	users := func(ids ...uint64) []models.User {
+		result := make([]models.User, 0, len(ids))
+		for _, id := range ids {
+			result = append(result, models.User{ID: id})
+		}
+		return result
+	}
+	cursorAt := func(id uint64) string { return encodeCursor(models.SortID, models.User{ID: id}) }
+
+	tests := []struct {
+		name     string
+		selected []models.User
+		page     models.PageRequest
+		wantIDs  []uint64
+		wantNext string
+		wantPrev string
+	}{
+		{
+			name:     "first page with more",
+			selected: users(1, 2, 3),
+			page:     models.PageRequest{Sort: models.SortID, Limit: 2},
+			wantIDs:  []uint64{1, 2},
+			wantNext: cursorAt(2),
+		},
+		{
+			name:     "single page",
+			selected: users(1, 2),
+			page:     models.PageRequest{Sort: models.SortID, Limit: 2},
+			wantIDs:  []uint64{1, 2},
+		},
+		{
+			name:     "middle page after cursor",
+			selected: users(3, 4, 5),
+			page:     models.PageRequest{Sort: models.SortID, Limit: 2, After: cursorAt(2)},
+			wantIDs:  []uint64{3, 4},
+			wantNext: cursorAt(4),
+			wantPrev: cursorAt(3),
+		},
+		{
+			name:     "last page after cursor",
+			selected: users(5),
+			page:     models.PageRequest{Sort: models.SortID, Limit: 2, After: cursorAt(4)},
+			wantIDs:  []uint64{5},
+			wantPrev: cursorAt(5),
+		},
+		{
+			name:     "previous page with more before",
+			selected: users(4, 3, 2),
+			page:     models.PageRequest{Sort: models.SortID, Limit: 2, Before: cursorAt(5)},
+			wantIDs:  []uint64{3, 4},
+			wantNext: cursorAt(4),
+			wantPrev: cursorAt(3),
+		},
+		{
+			name:     "previous page reaches start",
+			selected: users(2, 1),
+			page:     models.PageRequest{Sort: models.SortID, Limit: 2, Before: cursorAt(3)},
+			wantIDs:  []uint64{1, 2},
+			wantNext: cursorAt(2),
+		},
+		{
+			name:     "empty page",
+			selected: users(),
+			page:     models.PageRequest{Sort: models.SortID, Limit: 2, After: cursorAt(9)},
+			wantIDs:  []uint64{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cursorPage(tt.selected, tt.page)
+
+			ids := make([]uint64, 0, len(got.Users))
+			for _, user := range got.Users {
+				ids = append(ids, user.ID)
+			}
+			if len(ids) != len(tt.wantIDs) {
+				t.Fatalf("ids = %v, want %v", ids, tt.wantIDs)
+			}
+			for i := range ids {
+				if ids[i] != tt.wantIDs[i] {
+					t.Fatalf("ids = %v, want %v", ids, tt.wantIDs)
+				}
+			}
+			if got.Next != tt.wantNext {
+				t.Errorf("next = %q, want %q", got.Next, tt.wantNext)
+			}
+			if got.Prev != tt.wantPrev {
+				t.Errorf("prev = %q, want %q", got.Prev, tt.wantPrev)
+			}
+		})
+	}
+}
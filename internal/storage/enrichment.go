@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// Сохраненные результаты api для имен
+func (s *storage) GetNameEnrichments(ctx context.Context, names []string) ([]models.NameEnrichment, error) {
+	query := `SELECT name, age, age_count, COALESCE(age_country, ''), gender, gender_probability, gender_count,
+		COALESCE(gender_country, ''), nation, nation_count, fetched_at
+		FROM public.name_enrichment WHERE name = ANY($1)`
+
+	rows, err := s.conn.Query(ctx, query, names)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries = make([]models.NameEnrichment, 0, len(names))
+	for rows.Next() {
+		var (
+			entry  models.NameEnrichment
+			age    *int
+			gender *string
+			nation []byte
+		)
+		if err = rows.Scan(&entry.Name, &age, &entry.Age.Count, &entry.Age.Country, &gender, &entry.Gender.Probability,
+			&entry.Gender.Count, &entry.Gender.Country, &nation, &entry.Nation.Count, &entry.FetchedAt); err != nil {
+			return nil, err
+		}
+
+		// NULL - api не смог определить значение
+		entry.Age.Name = entry.Name
+		if age != nil {
+			entry.Age.Age = *age
+			entry.Age.Found = true
+		}
+		entry.Gender.Name = entry.Name
+		if gender != nil {
+			entry.Gender.Gender = *gender
+			entry.Gender.Found = true
+		}
+		entry.Nation.Name = entry.Name
+		if err = json.Unmarshal(nation, &entry.Nation.Country); err != nil {
+			return nil, err
+		}
+		entry.Nation.Found = len(entry.Nation.Country) > 0
+
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Сохранение результатов api, существующие записи перезаписываются
+func (s *storage) SaveNameEnrichments(ctx context.Context, entries []models.NameEnrichment) error {
+	query := `INSERT INTO public.name_enrichment
+		(name, age, age_count, gender, gender_probability, gender_count, nation, nation_count, fetched_at,
+			age_country, gender_country)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), NULLIF($11, ''))
+		ON CONFLICT (name) DO UPDATE SET
+			age = excluded.age, age_count = excluded.age_count, age_country = excluded.age_country,
+			gender = excluded.gender, gender_probability = excluded.gender_probability, gender_count = excluded.gender_count,
+			gender_country = excluded.gender_country,
+			nation = excluded.nation, nation_count = excluded.nation_count, fetched_at = excluded.fetched_at`
+
+	batch := &pgx.Batch{}
+	for _, entry := range entries {
+		var (
+			age    *int
+			gender *string
+		)
+		if entry.Age.Found {
+			age = &entry.Age.Age
+		}
+		if entry.Gender.Found {
+			gender = &entry.Gender.Gender
+		}
+
+		countries := entry.Nation.Country
+		if countries == nil {
+			countries = []models.Country{}
+		}
+		nation, err := json.Marshal(countries)
+		if err != nil {
+			return err
+		}
+
+		batch.Queue(query, entry.Name, age, entry.Age.Count, gender, entry.Gender.Probability, entry.Gender.Count,
+			nation, entry.Nation.Count, entry.FetchedAt, entry.Age.Country, entry.Gender.Country)
+	}
+
+	return s.conn.SendBatch(ctx, batch).Close()
+}
+
+// Удаление сохраненных результатов api для имени
+func (s *storage) DeleteNameEnrichment(ctx context.Context, name string) (bool, error) {
+	query := "DELETE FROM public.name_enrichment WHERE name = $1"
+
+	tag, err := s.conn.Exec(ctx, query, name)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// Захват очередных пользователей, ожидающих обогащения.
+// Захваченные строки откладываются на время lease, чтобы их не взяли другие обработчики;
+// если обработчик упадет, по истечении lease строки снова попадут в очередь
+func (s *storage) ClaimEnrichmentTasks(ctx context.Context, limit int, lease time.Duration) ([]models.EnrichmentTask, error) {
+	query := `WITH claimed AS (
+			SELECT id FROM public.users
+			WHERE enrichment_status = $1 AND (enrichment_next_at IS NULL OR enrichment_next_at <= now())
+			ORDER BY enrichment_next_at NULLS FIRST, id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE public.users u SET enrichment_next_at = now() + make_interval(secs => $3)
+		FROM claimed WHERE u.id = claimed.id
+		RETURNING u.id, u.name, u.patronymic, u.enrichment_attempts`
+
+	rows, err := s.conn.Query(ctx, query, models.EnrichmentPending, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks = make([]models.EnrichmentTask, 0, limit)
+	for rows.Next() {
+		var task models.EnrichmentTask
+		if err = rows.Scan(&task.ID, &task.Name, &task.Patronymic, &task.Attempts); err != nil {
+			return nil, err
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
+
+// Сохранение результатов обогащения. Пустые значения полей не затирают уже заполненные,
+// поля, заданные оператором или импортированные, не меняются
+func (s *storage) UpdateEnrichment(ctx context.Context, updates []models.EnrichmentUpdate) error {
+	query := `UPDATE public.users SET
+		age = CASE WHEN $2 <> 0 AND ` + apiOwned(models.FieldAge) + ` THEN $2 ELSE age END,
+		gender = CASE WHEN $3 <> '' AND ` + apiOwned(models.FieldGender) + ` THEN $3 ELSE gender END,
+		nation = CASE WHEN $4 <> '' AND ` + apiOwned(models.FieldNation) + ` THEN $4 ELSE nation END,
+		age_count = CASE WHEN $2 <> 0 AND ` + apiOwned(models.FieldAge) + ` THEN $9 ELSE age_count END,
+		gender_probability = CASE WHEN $3 <> '' AND ` + apiOwned(models.FieldGender) + ` THEN $10 ELSE gender_probability END,
+		nation_probability = CASE WHEN $4 <> '' AND ` + apiOwned(models.FieldNation) + ` THEN $11 ELSE nation_probability END,
+		gender_mismatch = CASE WHEN $3 <> '' AND ` + apiOwned(models.FieldGender) + ` THEN $12 ELSE gender_mismatch END,
+		age_country = CASE WHEN $2 <> 0 AND ` + apiOwned(models.FieldAge) + ` THEN NULLIF($13, '') ELSE age_country END,
+		gender_country = CASE WHEN $3 <> '' AND ` + apiOwned(models.FieldGender) + ` THEN NULLIF($14, '') ELSE gender_country END,
+		enrichment_status = $5,
+		enrichment_attempts = $6,
+		enrichment_next_at = $7,
+		enrichment_error = NULLIF($8, '')
+		WHERE id = $1`
+
+	batch := &pgx.Batch{}
+	for _, update := range updates {
+		var nextAt *time.Time
+		if !update.NextAt.IsZero() {
+			nextAt = &update.NextAt
+		}
+
+		batch.Queue(query, update.ID, update.Age, update.Gender, update.Nation,
+			update.Status, update.Attempts, nextAt, update.Error,
+			update.AgeCount, update.GenderProbability, update.NationProbability, update.GenderMismatch,
+			update.AgeCountry, update.GenderCountry)
+		queueUpdateSources(batch, update)
+		queueNationalities(batch, update)
+	}
+
+	return s.conn.SendBatch(ctx, batch).Close()
+}
+
+// Пользователи для повторного обогащения - очередная страница после afterID по возрастанию ID
+func (s *storage) GetUsersToReenrich(ctx context.Context, opts models.ReenrichOptions, afterID uint64, limit int) ([]models.User, error) {
+	query := "SELECT " + userColumns + " FROM public.users WHERE id > $1"
+	args := []any{afterID}
+
+	if opts.ID != 0 {
+		args = append(args, opts.ID)
+		query += fmt.Sprintf(" AND id = $%d", len(args))
+	}
+	if opts.Status != "" {
+		args = append(args, opts.Status)
+		query += fmt.Sprintf(" AND enrichment_status = $%d", len(args))
+	}
+	if opts.Incomplete {
+		query += " AND (age IS NULL OR gender IS NULL OR nation IS NULL)"
+	}
+
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY id LIMIT $%d", len(args))
+
+	users, err := s.queryUsers(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Источники нужны, чтобы не предлагать замену полей, заданных вручную
+	if err = s.loadSources(ctx, users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// Перезапись обогащенных полей после повторного обогащения.
+// Пустые значения не меняют поле, пустое состояние оставляет прежнее.
+// Поля, заданные оператором или импортированные, не меняются
+func (s *storage) ApplyReenrichment(ctx context.Context, updates []models.EnrichmentUpdate) error {
+	query := `UPDATE public.users SET
+		age = CASE WHEN $2 <> 0 AND ` + apiOwned(models.FieldAge) + ` THEN $2 ELSE age END,
+		gender = CASE WHEN $3 <> '' AND ` + apiOwned(models.FieldGender) + ` THEN $3 ELSE gender END,
+		nation = CASE WHEN $4 <> '' AND ` + apiOwned(models.FieldNation) + ` THEN $4 ELSE nation END,
+		age_count = CASE WHEN $2 <> 0 AND ` + apiOwned(models.FieldAge) + ` THEN $6 ELSE age_count END,
+		gender_probability = CASE WHEN $3 <> '' AND ` + apiOwned(models.FieldGender) + ` THEN $7 ELSE gender_probability END,
+		nation_probability = CASE WHEN $4 <> '' AND ` + apiOwned(models.FieldNation) + ` THEN $8 ELSE nation_probability END,
+		gender_mismatch = CASE WHEN $3 <> '' AND ` + apiOwned(models.FieldGender) + ` THEN $9 ELSE gender_mismatch END,
+		age_country = CASE WHEN $2 <> 0 AND ` + apiOwned(models.FieldAge) + ` THEN NULLIF($10, '') ELSE age_country END,
+		gender_country = CASE WHEN $3 <> '' AND ` + apiOwned(models.FieldGender) + ` THEN NULLIF($11, '') ELSE gender_country END,
+		enrichment_status = COALESCE(NULLIF($5, ''), enrichment_status),
+		enrichment_error = CASE WHEN $5 = '' THEN enrichment_error ELSE NULL END,
+		enrichment_next_at = CASE WHEN $5 = '' THEN enrichment_next_at ELSE NULL END,
+		enrichment_attempts = CASE WHEN $5 = '' THEN enrichment_attempts ELSE 0 END
+		WHERE id = $1`
+
+	batch := &pgx.Batch{}
+	for _, update := range updates {
+		batch.Queue(query, update.ID, update.Age, update.Gender, update.Nation, update.Status,
+			update.AgeCount, update.GenderProbability, update.NationProbability, update.GenderMismatch,
+			update.AgeCountry, update.GenderCountry)
+		queueUpdateSources(batch, update)
+		queueNationalities(batch, update)
+	}
+
+	return s.conn.SendBatch(ctx, batch).Close()
+}
+
+// Заменяем все страны, предложенные api для пользователя, если национальность обновляется.
+// Если национальность задана вручную или при импорте, страны api к ней не относятся - не трогаем их
+func queueNationalities(batch *pgx.Batch, update models.EnrichmentUpdate) {
+	if update.Nation == "" {
+		return
+	}
+
+	batch.Queue(`DELETE FROM public.user_nationalities n USING public.users
+		WHERE n.user_id = $1 AND users.id = n.user_id AND `+apiOwned(models.FieldNation), update.ID)
+	if len(update.Nationalities) == 0 {
+		return
+	}
+
+	countries := make([]string, 0, len(update.Nationalities))
+	probabilities := make([]float64, 0, len(update.Nationalities))
+	for _, country := range update.Nationalities {
+		countries = append(countries, country.Country_id)
+		probabilities = append(probabilities, country.Probability)
+	}
+
+	batch.Queue(`INSERT INTO public.user_nationalities (user_id, country_id, probability)
+		SELECT users.id, unnest($2::varchar[]), unnest($3::float8[]) FROM public.users
+		WHERE users.id = $1 AND `+apiOwned(models.FieldNation), update.ID, countries, probabilities)
+}
+
+// Национальность задана оператором: страны, предложенные api, заменяем заданной страной с полной уверенностью
+func replaceNationalities(ctx context.Context, tx pgx.Tx, userID int, nation string) error {
+	if _, err := tx.Exec(ctx, "DELETE FROM public.user_nationalities WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	if nation == "" {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, `INSERT INTO public.user_nationalities (user_id, country_id, probability)
+		VALUES ($1, $2, 1)`, userID, nation)
+	return err
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+)
+
+// Условия WHERE, собираемые по частям. Значения передаются только параметрами запроса
+type conditions struct {
+	parts []string
+	args  []any
+}
+
+// Добавляем параметр запроса и возвращаем его обозначение ($1, $2, ...)
+func (c *conditions) arg(value any) string {
+	c.args = append(c.args, value)
+	return fmt.Sprintf("$%d", len(c.args))
+}
+
+func (c *conditions) add(condition string) {
+	c.parts = append(c.parts, condition)
+}
+
+// Условия через AND, пустая строка - условий нет
+func (c *conditions) where() string {
+	if len(c.parts) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(c.parts, " AND ")
+}
+
+// Условия WHERE и параметры запроса для фильтра пользователей
+func filterConditions(filter models.UserFilter) *conditions {
+	c := &conditions{}
+
+	if filter.AgeMin > 0 {
+		c.add("age >= " + c.arg(filter.AgeMin))
+	}
+	if filter.AgeMax > 0 {
+		c.add("age <= " + c.arg(filter.AgeMax))
+	}
+	if filter.Gender != "" {
+		c.add("gender = " + c.arg(filter.Gender))
+	}
+	if len(filter.Nations) > 0 {
+		if filter.MinNationProbability > 0 {
+			c.add(`EXISTS (SELECT 1 FROM public.user_nationalities n
+				WHERE n.user_id = users.id AND n.country_id = ANY(` + c.arg(filter.Nations) + `)
+				AND n.probability >= ` + c.arg(filter.MinNationProbability) + ")")
+		} else {
+			c.add("nation = ANY(" + c.arg(filter.Nations) + ")")
+		}
+	}
+	if filter.Name != "" {
+		pattern := c.arg("%" + likeEscaper.Replace(filter.Name) + "%")
+		c.add("(surname ILIKE " + pattern + " OR name ILIKE " + pattern + " OR patronymic ILIKE " + pattern + ")")
+	}
+	if !filter.CreatedFrom.IsZero() {
+		c.add("created_at >= " + c.arg(filter.CreatedFrom))
+	}
+	if !filter.CreatedTo.IsZero() {
+		c.add("created_at < " + c.arg(filter.CreatedTo))
+	}
+
+	return c
+}
+
+// Символы шаблона LIKE в строке поиска ищутся как обычные символы
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
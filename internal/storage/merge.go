@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// Пары пользователей с похожими ФИО по триграммам, самые похожие - первыми.
+// Для каждого пользователя по индексу берутся только neighbors ближайших, так что запрос
+// не сравнивает всех со всеми. Это только кандидаты - насколько ФИО действительно близки, решает сервис
+func (s *storage) GetDuplicateCandidates(ctx context.Context, neighbors int, limit int) ([]models.DuplicatePair, error) {
+	query := `SELECT first_id, second_id FROM (
+			SELECT DISTINCT LEAST(a.id, b.id) AS first_id, GREATEST(a.id, b.id) AS second_id,
+				similarity(a.full_name, b.full_name) AS score
+			FROM public.users a
+			CROSS JOIN LATERAL (
+				SELECT n.id, n.full_name FROM public.users n
+				WHERE n.id <> a.id
+				ORDER BY n.full_name <-> a.full_name
+				LIMIT $1
+			) b
+			WHERE a.full_name % b.full_name
+		) pairs
+		ORDER BY score DESC, first_id, second_id
+		LIMIT $2`
+
+	rows, err := s.conn.Query(ctx, query, neighbors, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		pairs [][2]uint64
+		ids   []uint64
+	)
+	for rows.Next() {
+		var pair [2]uint64
+		if err = rows.Scan(&pair[0], &pair[1]); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+		ids = append(ids, pair[0], pair[1])
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	users, err := s.queryUsers(ctx, "SELECT "+userColumns+" FROM public.users WHERE id = ANY($1)", ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint64]models.User, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+
+	var result = make([]models.DuplicatePair, 0, len(pairs))
+	for _, pair := range pairs {
+		result = append(result, models.DuplicatePair{First: byID[pair[0]], Second: byID[pair[1]]})
+	}
+
+	return result, nil
+}
+
+// Слияние двух пользователей: сохраняемый получает выбранные поля удаляемого вместе с уверенностью api
+// и источником значения, проверки удаляемого переходят к сохраняемому, удаляемый удаляется.
+// Оба пользователя до слияния записываются в журнал user_merges
+func (s *storage) MergeUsers(ctx context.Context, merge models.MergeRequest) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Блокируем обоих, чтобы их не изменили во время слияния
+	var removed models.User
+	query := "SELECT " + userColumns + " FROM public.users WHERE id = ANY($1) ORDER BY id FOR UPDATE"
+	rows, err := tx.Query(ctx, query, []int{merge.KeepID, merge.RemoveID})
+	if err != nil {
+		return err
+	}
+	found := 0
+	for rows.Next() {
+		var user models.User
+		if err = scanUser(rows, &user); err != nil {
+			rows.Close()
+			return err
+		}
+		if int(user.ID) == merge.RemoveID {
+			removed = user
+		}
+		found++
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if found < 2 {
+		return ErrUserNotFound
+	}
+
+	query = `INSERT INTO public.user_merges (kept_user_id, removed_user_id, kept_user, removed_user, fields, merger)
+		SELECT $1, $2, to_jsonb(k) - 'search_vector', to_jsonb(r) - 'search_vector', $3, $4
+		FROM public.users k, public.users r WHERE k.id = $1 AND r.id = $2`
+	if _, err = tx.Exec(ctx, query, merge.KeepID, merge.RemoveID, merge.Take, merge.Merger); err != nil {
+		return err
+	}
+
+	// Источники значений и страны, предложенные api, переходят вместе с полями
+	batch := &pgx.Batch{}
+	batch.Queue("DELETE FROM public.user_field_sources WHERE user_id = $1 AND field = ANY($2)", merge.KeepID, merge.Take)
+	batch.Queue(`INSERT INTO public.user_field_sources (user_id, field, source, actor, updated_at)
+		SELECT $1, field, source, actor, updated_at FROM public.user_field_sources
+		WHERE user_id = $2 AND field = ANY($3)`, merge.KeepID, merge.RemoveID, merge.Take)
+	// Значение без источника у удаляемого считается выбранным при слиянии вручную
+	batch.Queue(`INSERT INTO public.user_field_sources (user_id, field, source, actor, updated_at)
+		SELECT $1, unnest($2::varchar[]), $3, NULLIF($4, ''), now()
+		ON CONFLICT (user_id, field) DO NOTHING`,
+		merge.KeepID, takenValues(removed, merge.Take), models.SourceManual, merge.Merger)
+	if contains(merge.Take, models.FieldNation) {
+		batch.Queue("DELETE FROM public.user_nationalities WHERE user_id = $1", merge.KeepID)
+		batch.Queue(`INSERT INTO public.user_nationalities (user_id, country_id, probability)
+			SELECT $1, country_id, probability FROM public.user_nationalities WHERE user_id = $2`,
+			merge.KeepID, merge.RemoveID)
+	}
+	batch.Queue("UPDATE public.enrichment_reviews SET user_id = $1 WHERE user_id = $2", merge.KeepID, merge.RemoveID)
+	// Удаляем до обновления, иначе ФИО, взятое у удаляемого, нарушит уникальность
+	batch.Queue("DELETE FROM public.users WHERE id = $1", merge.RemoveID)
+	batch.Queue(`UPDATE public.users SET
+		name = CASE WHEN 'name' = ANY($2) THEN $3 ELSE name END,
+		surname = CASE WHEN 'surname' = ANY($2) THEN $4 ELSE surname END,
+		patronymic = CASE WHEN 'patronymic' = ANY($2) THEN $5 ELSE patronymic END,
+		age = CASE WHEN 'age' = ANY($2) THEN NULLIF($6::integer, 0) ELSE age END,
+		age_count = CASE WHEN 'age' = ANY($2) THEN NULLIF($7::integer, 0) ELSE age_count END,
+		age_country = CASE WHEN 'age' = ANY($2) THEN NULLIF($8, '') ELSE age_country END,
+		gender = CASE WHEN 'gender' = ANY($2) THEN NULLIF($9, '') ELSE gender END,
+		gender_probability = CASE WHEN 'gender' = ANY($2) THEN NULLIF($10::float8, 0) ELSE gender_probability END,
+		gender_country = CASE WHEN 'gender' = ANY($2) THEN NULLIF($11, '') ELSE gender_country END,
+		gender_mismatch = CASE WHEN 'gender' = ANY($2) THEN $12 ELSE gender_mismatch END,
+		nation = CASE WHEN 'nation' = ANY($2) THEN NULLIF($13, '') ELSE nation END,
+		nation_probability = CASE WHEN 'nation' = ANY($2) THEN NULLIF($14::float8, 0) ELSE nation_probability END
+		WHERE id = $1`,
+		merge.KeepID, merge.Take, removed.Name, removed.Surname, removed.Patronymic,
+		removed.Age, removed.AgeCount, removed.AgeCountry,
+		removed.Gender, removed.GenderProbability, removed.GenderCountry, removed.GenderMismatch,
+		removed.Nation, removed.NationProbability)
+
+	err = tx.SendBatch(ctx, batch).Close()
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Журнал слияний, последние - первыми
+func (s *storage) ListMerges(ctx context.Context) ([]models.Merge, error) {
+	query := `SELECT id, kept_user_id, removed_user_id, kept_user, removed_user, fields, merger, created_at
+		FROM public.user_merges ORDER BY id DESC`
+
+	rows, err := s.conn.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var merges = make([]models.Merge, 0)
+	for rows.Next() {
+		var merge models.Merge
+		if err = rows.Scan(&merge.ID, &merge.KeptUserID, &merge.RemovedUserID, &merge.KeptUser, &merge.RemovedUser,
+			&merge.Fields, &merge.Merger, &merge.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		merges = append(merges, merge)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return merges, nil
+}
+
+// Обогащаемые поля, взятые у удаляемого пользователя, в которых есть значение
+func takenValues(removed models.User, take []string) []string {
+	filled := updatedFields(models.EnrichmentUpdate{Age: removed.Age, Gender: removed.Gender, Nation: removed.Nation})
+
+	fields := make([]string, 0, len(filled))
+	for _, field := range filled {
+		if contains(take, field) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
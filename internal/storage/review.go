@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+)
+
+// Пользователи, еще не проверенные оператором, у которых api не определил пол, возраст
+// или национальность либо уверенность api ниже threshold. Поля, заданные вручную или импортированные, не проверяются
+func (s *storage) GetReviewQueue(ctx context.Context, threshold float64) ([]models.User, error) {
+	query := "SELECT " + userColumns + ` FROM public.users
+		WHERE reviewed_at IS NULL AND enrichment_status <> $1
+		AND ((age IS NULL AND ` + apiOwned(models.FieldAge) + `)
+			OR ((gender IS NULL OR gender_mismatch OR COALESCE(gender_probability, 0) < $2) AND ` + apiOwned(models.FieldGender) + `)
+			OR ((nation IS NULL OR COALESCE(nation_probability, 0) < $2) AND ` + apiOwned(models.FieldNation) + `))
+		ORDER BY id`
+
+	return s.queryUsers(ctx, query, models.EnrichmentPending, threshold)
+}
+
+// Сохранение проверки: новые значения полей, их источник, решения по каждому полю и отметка о проверке
+func (s *storage) SaveReview(ctx context.Context, review models.Review) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Страна уточнения относится только к значению api - при замене значения сбрасываем ее
+	query := `UPDATE public.users SET age = $2, gender = $3, nation = $4,
+		age_country = CASE WHEN age IS DISTINCT FROM $2 THEN NULL ELSE age_country END,
+		gender_country = CASE WHEN gender IS DISTINCT FROM $3 THEN NULL ELSE gender_country END,
+		gender_mismatch = false, reviewed_at = now() WHERE id = $1`
+	if _, err = tx.Exec(ctx, query, review.UserID, review.Age, review.Gender, review.Nation); err != nil {
+		return err
+	}
+
+	query = `INSERT INTO public.enrichment_reviews (user_id, field, action, old_value, new_value, reviewer)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	fields := make([]string, 0, len(review.Decisions))
+	for _, decision := range review.Decisions {
+		if _, err = tx.Exec(ctx, query, review.UserID, decision.Field, decision.Action,
+			decision.OldValue, decision.NewValue, review.Reviewer); err != nil {
+			return err
+		}
+		fields = append(fields, decision.Field)
+	}
+
+	// Проверенные поля считаются заданными оператором - api их больше не меняет
+	if _, err = tx.Exec(ctx, upsertSourcesQuery, review.UserID, fields, models.SourceManual, review.Reviewer); err != nil {
+		return err
+	}
+	if err = replaceNationalities(ctx, tx, review.UserID, review.Nation); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
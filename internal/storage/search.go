@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+)
+
+// Поиск пользователей по ФИО: совпадение начала слов (tsquery с префиксами) или похожесть
+// слов по триграммам, что находит и написания с опечатками. Лучшие совпадения - первыми
+func (s *storage) SearchUsers(ctx context.Context, tsQuery string, text string, limit int) ([]models.SearchResult, error) {
+	query := "SELECT " + userColumns + `,
+			ts_rank(search_vector, to_tsquery('simple', $1)) + word_similarity($2, full_name) AS rank
+		FROM public.users
+		WHERE search_vector @@ to_tsquery('simple', $1) OR $2 <% full_name
+		ORDER BY rank DESC, id
+		LIMIT $3`
+
+	rows, err := s.conn.Query(ctx, query, tsQuery, text, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results = make([]models.SearchResult, 0)
+	for rows.Next() {
+		var result models.SearchResult
+		if err = rows.Scan(append(userFields(&result.User), &result.Rank)...); err != nil {
+			return nil, err
+		}
+
+		results = append(results, result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
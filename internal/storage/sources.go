@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// Запись источника значений полей. Автоматически полученные данные не перезаписывают источник,
+// если значение было задано оператором или импортировано.
+// Строки берутся из users, чтобы удаленный тем временем пользователь не прерывал пакет запросов
+const upsertSourcesQuery = `INSERT INTO public.user_field_sources (user_id, field, source, actor, updated_at)
+	SELECT id, unnest($2::varchar[]), $3, NULLIF($4, ''), now() FROM public.users WHERE id = $1
+	ON CONFLICT (user_id, field) DO UPDATE SET
+		source = excluded.source, actor = excluded.actor, updated_at = excluded.updated_at
+	WHERE excluded.source IN ('manual', 'import') OR user_field_sources.source NOT IN ('manual', 'import')`
+
+// Условие для UPDATE public.users: поле можно заполнить данными api - оно не задано вручную и не импортировано
+func apiOwned(field string) string {
+	return fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM public.user_field_sources f
+		WHERE f.user_id = users.id AND f.field = '%s' AND f.source IN ('%s', '%s'))`,
+		field, models.SourceManual, models.SourceImport)
+}
+
+// Добавляем в пакет запись источника для полей пользователя
+func queueSources(batch *pgx.Batch, userID int, fields []string, source string, actor string) {
+	if len(fields) == 0 {
+		return
+	}
+	batch.Queue(upsertSourcesQuery, userID, fields, source, actor)
+}
+
+// Добавляем в пакет источники полей, заполненных обогащением. Поля с одинаковым источником
+// записываются одним запросом, пустой источник - api
+func queueUpdateSources(batch *pgx.Batch, update models.EnrichmentUpdate) {
+	sources := map[string]string{
+		models.FieldAge:    update.AgeSource,
+		models.FieldGender: update.GenderSource,
+		models.FieldNation: update.NationSource,
+	}
+
+	var order []string
+	bySource := make(map[string][]string)
+	for _, field := range updatedFields(update) {
+		source := sources[field]
+		if source == "" {
+			source = models.SourceAPI
+		}
+		if _, ok := bySource[source]; !ok {
+			order = append(order, source)
+		}
+		bySource[source] = append(bySource[source], field)
+	}
+
+	for _, source := range order {
+		queueSources(batch, update.ID, bySource[source], source, "")
+	}
+}
+
+// Поля, которые заполняет результат обогащения
+func updatedFields(update models.EnrichmentUpdate) []string {
+	fields := make([]string, 0, 3)
+	if update.Age != 0 {
+		fields = append(fields, models.FieldAge)
+	}
+	if update.Gender != "" {
+		fields = append(fields, models.FieldGender)
+	}
+	if update.Nation != "" {
+		fields = append(fields, models.FieldNation)
+	}
+	return fields
+}
+
+// Заполняем источники значений полей для списка пользователей
+func (s *storage) loadSources(ctx context.Context, users []models.User) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(users))
+	index := make(map[uint64]int, len(users))
+	for i, user := range users {
+		ids = append(ids, int64(user.ID))
+		index[user.ID] = i
+	}
+
+	query := `SELECT user_id, field, source, COALESCE(actor, ''), updated_at
+		FROM public.user_field_sources WHERE user_id = ANY($1) ORDER BY user_id, field`
+
+	rows, err := s.conn.Query(ctx, query, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			userID uint64
+			source models.FieldSource
+		)
+		if err = rows.Scan(&userID, &source.Field, &source.Source, &source.Actor, &source.UpdatedAt); err != nil {
+			return err
+		}
+		if i, ok := index[userID]; ok {
+			users[i].Sources = append(users[i].Sources, source)
+		}
+	}
+
+	return rows.Err()
+}
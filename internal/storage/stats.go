@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/Yury132/Golang-Task-4/internal/models"
+)
+
+// Учитываем значение поля, заданное оператором для имени
+func (s *storage) LearnName(ctx context.Context, name string, field string, value string) error {
+	query := `INSERT INTO public.name_stats (name, field, value, votes, updated_at) VALUES ($1, $2, $3, 1, now())
+		ON CONFLICT (name, field, value) DO UPDATE SET votes = name_stats.votes + 1, updated_at = now()`
+
+	_, err := s.conn.Exec(ctx, query, name, field, value)
+	return err
+}
+
+// Накопленные значения для имен
+func (s *storage) GetNameStats(ctx context.Context, names []string) ([]models.NameStat, error) {
+	query := `SELECT name, field, value, votes, updated_at FROM public.name_stats
+		WHERE name = ANY($1) ORDER BY name, field, votes DESC`
+
+	return s.queryNameStats(ctx, query, names)
+}
+
+// Все накопленные значения - для просмотра администратором
+func (s *storage) ListNameStats(ctx context.Context) ([]models.NameStat, error) {
+	query := `SELECT name, field, value, votes, updated_at FROM public.name_stats
+		ORDER BY name, field, votes DESC`
+
+	return s.queryNameStats(ctx, query)
+}
+
+// Выполняем запрос, возвращающий накопленные значения
+func (s *storage) queryNameStats(ctx context.Context, query string, args ...any) ([]models.NameStat, error) {
+	rows, err := s.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats = make([]models.NameStat, 0)
+	for rows.Next() {
+		var stat models.NameStat
+		if err = rows.Scan(&stat.Name, &stat.Field, &stat.Value, &stat.Votes, &stat.UpdatedAt); err != nil {
+			return nil, err
+		}
+
+		stats = append(stats, stat)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
@@ -2,41 +2,96 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/Yury132/Golang-Task-4/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Пользователь с указанным ID не найден
+var ErrUserNotFound = errors.New("user not found")
+
+// Пользователь с таким же ФИО (без учета регистра) уже есть
+var ErrDuplicate = errors.New("user already exists")
+
+// Код ошибки PostgreSQL при нарушении уникальности
+const uniqueViolation = "23505"
+
 type Storage interface {
-	// Получение всех пользователей БД
-	GetUsersList(ctx context.Context) ([]models.User, error)
-	// Получение определенных пользователей по возрасту
-	GetUsersListAge(ctx context.Context, ageMin int, ageMax int) ([]models.User, error)
-	// Получение определенных пользователей по полу
-	GetUsersListGender(ctx context.Context, gender string) ([]models.User, error)
-	// Получение определенных пользователей по национальности
-	GetUsersListNation(ctx context.Context, nation string) ([]models.User, error)
-	// Проверка на существование пользователя
-	CheckUser(ctx context.Context, name string, surname string, patronymic string) (bool, error)
-	// Создание нового пользователя
-	CreateUser(ctx context.Context, name string, surname string, patronymic string, age int, gender string, nation string) error
+	// Страница пользователей БД, подходящих под все условия фильтра
+	GetUsersList(ctx context.Context, filter models.UserFilter, page models.PageRequest) (models.UserPage, error)
+	// Поиск пользователей по ФИО, лучшие совпадения - первыми
+	SearchUsers(ctx context.Context, tsQuery string, text string, limit int) ([]models.SearchResult, error)
+	// Создание нового пользователя, ErrDuplicate - пользователь с таким ФИО уже есть
+	CreateUser(ctx context.Context, name string, surname string, patronymic string) (int, error)
+	// Создание множества пользователей, уже существующие пропускаются
+	CreateUsers(ctx context.Context, users []models.User) (int, error)
 	// Удаление пользователя
 	DeleteUser(ctx context.Context, id int) error
 	// Получение конкретного пользователя по ID
 	GetUser(ctx context.Context, id int) (models.User, error)
-	// Обновление данных конкретного пользователя по ID
-	EditUser(ctx context.Context, id int, getUserName string, getUserSurname string, getUserPatronymic string) error
+	// Обновление данных конкретного пользователя по ID, пустые значения не меняют поле
+	EditUser(ctx context.Context, id int, edit models.UserEdit) error
+	// Сохраненные результаты api для имен
+	GetNameEnrichments(ctx context.Context, names []string) ([]models.NameEnrichment, error)
+	// Сохранение результатов api
+	SaveNameEnrichments(ctx context.Context, entries []models.NameEnrichment) error
+	// Удаление сохраненных результатов api для имени
+	DeleteNameEnrichment(ctx context.Context, name string) (bool, error)
+	// Захват очередных пользователей, ожидающих обогащения
+	ClaimEnrichmentTasks(ctx context.Context, limit int, lease time.Duration) ([]models.EnrichmentTask, error)
+	// Сохранение результатов обогащения
+	UpdateEnrichment(ctx context.Context, updates []models.EnrichmentUpdate) error
+	// Пользователи для повторного обогащения - очередная страница после afterID
+	GetUsersToReenrich(ctx context.Context, opts models.ReenrichOptions, afterID uint64, limit int) ([]models.User, error)
+	// Перезапись обогащенных полей после повторного обогащения
+	ApplyReenrichment(ctx context.Context, updates []models.EnrichmentUpdate) error
+	// Пользователи с неуверенными результатами api, еще не проверенные оператором
+	GetReviewQueue(ctx context.Context, threshold float64) ([]models.User, error)
+	// Сохранение проверки пользователя оператором
+	SaveReview(ctx context.Context, review models.Review) error
+	// Учитываем значение поля, заданное оператором для имени
+	LearnName(ctx context.Context, name string, field string, value string) error
+	// Накопленные из исправлений операторов значения для имен
+	GetNameStats(ctx context.Context, names []string) ([]models.NameStat, error)
+	// Все накопленные значения
+	ListNameStats(ctx context.Context) ([]models.NameStat, error)
+	// Пары пользователей с похожими ФИО
+	GetDuplicateCandidates(ctx context.Context, neighbors int, limit int) ([]models.DuplicatePair, error)
+	// Слияние двух пользователей в одного с записью в журнал
+	MergeUsers(ctx context.Context, merge models.MergeRequest) error
+	// Журнал слияний
+	ListMerges(ctx context.Context) ([]models.Merge, error)
 }
 
+// Поля пользователя для выборки - обогащенные поля могут быть еще не заполнены
+const userColumns = "id, name, surname, patronymic, COALESCE(age, 0), COALESCE(gender, ''), COALESCE(nation, ''), " +
+	"COALESCE(age_count, 0), COALESCE(gender_probability, 0), COALESCE(nation_probability, 0), " +
+	"COALESCE(age_country, ''), COALESCE(gender_country, ''), gender_mismatch, enrichment_status, created_at"
+
 type storage struct {
 	conn *pgxpool.Pool
 }
 
-// Все пользователи в БД
-func (s *storage) GetUsersList(ctx context.Context) ([]models.User, error) {
-	query := "SELECT id, name, surname, patronymic, age, gender, nation FROM public.users"
+// Считываем пользователя, выбранного по userColumns
+func scanUser(row pgx.Row, user *models.User) error {
+	return row.Scan(userFields(user)...)
+}
+
+// Поля пользователя в порядке userColumns - для запросов, выбирающих кроме них что-то еще
+func userFields(user *models.User) []any {
+	return []any{&user.ID, &user.Name, &user.Surname, &user.Patronymic, &user.Age, &user.Gender, &user.Nation,
+		&user.AgeCount, &user.GenderProbability, &user.NationProbability, &user.AgeCountry, &user.GenderCountry,
+		&user.GenderMismatch, &user.EnrichmentStatus, &user.CreatedAt}
+}
 
-	rows, err := s.conn.Query(ctx, query)
+// Выполняем запрос, возвращающий список пользователей по userColumns
+func (s *storage) queryUsers(ctx context.Context, query string, args ...any) ([]models.User, error) {
+	rows, err := s.conn.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -45,137 +100,137 @@ func (s *storage) GetUsersList(ctx context.Context) ([]models.User, error) {
 	var users = make([]models.User, 0)
 	for rows.Next() {
 		var user models.User
-		if err = rows.Scan(&user.ID, &user.Name, &user.Surname, &user.Patronymic, &user.Age, &user.Gender, &user.Nation); err != nil {
+		if err = scanUser(rows, &user); err != nil {
 			return nil, err
 		}
 
 		users = append(users, user)
 	}
 
-	if rows.Err() != nil {
+	if err = rows.Err(); err != nil {
 		return nil, err
 	}
 
 	return users, nil
 }
 
-// Получение определенных пользователей по возрасту
-func (s *storage) GetUsersListAge(ctx context.Context, ageMin int, ageMax int) ([]models.User, error) {
-	query := "SELECT id, name, surname, patronymic, age, gender, nation FROM public.users WHERE age >= $1 AND age <= $2"
+// Страница пользователей, подходящих под все условия фильтра.
+// Страницы выбираются по курсору - значению поля сортировки и ID последнего (первого) пользователя
+// соседней страницы, поэтому не зависят от размера таблицы
+func (s *storage) GetUsersList(ctx context.Context, filter models.UserFilter, page models.PageRequest) (models.UserPage, error) {
+	result := models.UserPage{Users: make([]models.User, 0)}
 
-	rows, err := s.conn.Query(ctx, query, ageMin, ageMax)
-	if err != nil {
-		return nil, err
+	column, ok := sortColumns[page.Sort]
+	if !ok {
+		return result, fmt.Errorf("unknown sort field %q", page.Sort)
 	}
-	defer rows.Close()
-
-	var users = make([]models.User, 0)
-	for rows.Next() {
-		var user models.User
-		if err = rows.Scan(&user.ID, &user.Name, &user.Surname, &user.Patronymic, &user.Age, &user.Gender, &user.Nation); err != nil {
-			return nil, err
-		}
-
-		users = append(users, user)
-	}
-
-	if rows.Err() != nil {
-		return nil, err
-	}
-
-	return users, nil
-}
 
-// Получение определенных пользователей по полу
-func (s *storage) GetUsersListGender(ctx context.Context, gender string) ([]models.User, error) {
-	query := "SELECT id, name, surname, patronymic, age, gender, nation FROM public.users WHERE gender = $1"
+	c := filterConditions(filter)
 
-	rows, err := s.conn.Query(ctx, query, gender)
-	if err != nil {
-		return nil, err
+	// Для предыдущей страницы идем от курсора в обратную сторону, затем разворачиваем результат
+	backward := page.Before != ""
+	cursorValue := page.After
+	if backward {
+		cursorValue = page.Before
 	}
-	defer rows.Close()
+	desc := page.Desc != backward
 
-	var users = make([]models.User, 0)
-	for rows.Next() {
-		var user models.User
-		if err = rows.Scan(&user.ID, &user.Name, &user.Surname, &user.Patronymic, &user.Age, &user.Gender, &user.Nation); err != nil {
-			return nil, err
+	if cursorValue != "" {
+		cur, err := decodeCursor(cursorValue, page.Sort)
+		if err != nil {
+			return result, err
 		}
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		c.add(fmt.Sprintf("(%s, id) %s (%s::%s, %s)", column.expr, op, c.arg(cur.Value), column.cast, c.arg(cur.ID)))
+	}
 
-		users = append(users, user)
+	order := "ASC"
+	if desc {
+		order = "DESC"
 	}
+	// Лишняя строка показывает, есть ли пользователи дальше
+	query := "SELECT " + userColumns + " FROM public.users" + c.where() +
+		fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %s", column.expr, order, order, c.arg(page.Limit+1))
 
-	if rows.Err() != nil {
-		return nil, err
+	users, err := s.queryUsers(ctx, query, c.args...)
+	if err != nil {
+		return result, err
 	}
 
-	return users, nil
+	return cursorPage(users, page), nil
 }
 
-// Получение определенных пользователей по национальности
-func (s *storage) GetUsersListNation(ctx context.Context, nation string) ([]models.User, error) {
-	query := "SELECT id, name, surname, patronymic, age, gender, nation FROM public.users WHERE nation = $1"
+// Создание нового пользователя - обогащаемые поля заполнит фоновая обработка.
+// Совпадение ФИО проверяет уникальный индекс, так что одновременные запросы не создадут дубликат
+func (s *storage) CreateUser(ctx context.Context, name string, surname string, patronymic string) (int, error) {
+	query := `INSERT INTO public.users (name, surname, patronymic, enrichment_status) values ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING RETURNING id`
 
-	rows, err := s.conn.Query(ctx, query, nation)
+	var id int
+	err := s.conn.QueryRow(ctx, query, name, surname, patronymic, models.EnrichmentPending).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrDuplicate
+	}
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer rows.Close()
+	return id, nil
+}
 
-	var users = make([]models.User, 0)
-	for rows.Next() {
-		var user models.User
-		if err = rows.Scan(&user.ID, &user.Name, &user.Surname, &user.Patronymic, &user.Age, &user.Gender, &user.Nation); err != nil {
-			return nil, err
+// Создание множества пользователей одним пакетом запросов, уже существующие пропускаются.
+// Переданные возраст, пол и национальность сохраняются с источником "импорт".
+// Возвращает количество добавленных
+func (s *storage) CreateUsers(ctx context.Context, users []models.User) (int, error) {
+	query := `WITH created AS (
+			INSERT INTO public.users (name, surname, patronymic, age, gender, nation, enrichment_status)
+			VALUES ($1, $2, $3, NULLIF($4, 0), NULLIF($5, ''), NULLIF($6, ''), $7)
+			ON CONFLICT DO NOTHING
+			RETURNING id
+		), sources AS (
+			INSERT INTO public.user_field_sources (user_id, field, source)
+			SELECT id, unnest($8::varchar[]), $9 FROM created
+		)
+		SELECT count(*) FROM created`
+
+	batch := &pgx.Batch{}
+	for _, user := range users {
+		fields := make([]string, 0, 3)
+		if user.Age != 0 {
+			fields = append(fields, models.FieldAge)
+		}
+		if user.Gender != "" {
+			fields = append(fields, models.FieldGender)
+		}
+		if user.Nation != "" {
+			fields = append(fields, models.FieldNation)
 		}
 
-		users = append(users, user)
-	}
-
-	if rows.Err() != nil {
-		return nil, err
-	}
-
-	return users, nil
-}
-
-// Проверка на существование пользователя
-func (s *storage) CheckUser(ctx context.Context, name string, surname string, patronymic string) (bool, error) {
-	query := "SELECT id FROM public.users WHERE name = $1 AND surname = $2 AND patronymic = $3"
+		// Все поля переданы - обращаться к api не нужно
+		status := models.EnrichmentPending
+		if len(fields) == 3 {
+			status = models.EnrichmentEnriched
+		}
 
-	rows, err := s.conn.Query(ctx, query, name, surname, patronymic)
-	if err != nil {
-		return false, err
+		batch.Queue(query, user.Name, user.Surname, user.Patronymic, user.Age, user.Gender, user.Nation, status,
+			fields, models.SourceImport)
 	}
-	defer rows.Close()
 
-	// Считаем количество строк
-	countRows := 0
-	for rows.Next() {
-		countRows++
-	}
-	// Если что то нашли, значит пользователь есть в БД
-	check := false
-	if countRows > 0 {
-		check = true
-	}
+	results := s.conn.SendBatch(ctx, batch)
+	defer results.Close()
 
-	if rows.Err() != nil {
-		return false, err
+	created := 0
+	for range users {
+		var count int
+		if err := results.QueryRow().Scan(&count); err != nil {
+			return created, err
+		}
+		created += count
 	}
 
-	return check, nil
-}
-
-// Создание нового пользователя
-func (s *storage) CreateUser(ctx context.Context, name string, surname string, patronymic string, age int, gender string, nation string) error {
-	query := "INSERT INTO public.users (name, surname, patronymic, age, gender, nation) values ($1, $2, $3, $4, $5, $6)"
-	_, err := s.conn.Exec(ctx, query, name, surname, patronymic, age, gender, nation)
-	if err != nil {
-		return err
-	}
-	return nil
+	return created, nil
 }
 
 // Удаление пользователя
@@ -195,25 +250,100 @@ func (s *storage) GetUser(ctx context.Context, id int) (models.User, error) {
 	// Структура
 	var user models.User
 	// Запрос - Получаем только одну строку
-	query := "SELECT id, name, surname, patronymic, age, gender, nation FROM public.users WHERE id = $1"
+	query := "SELECT " + userColumns + " FROM public.users WHERE id = $1"
 	// Выполняем запрос, возвращающий только одну строку
 	row := s.conn.QueryRow(ctx, query, id)
 
 	// Считываем значение
-	if err := row.Scan(&user.ID, &user.Name, &user.Surname, &user.Patronymic, &user.Age, &user.Gender, &user.Nation); err != nil {
+	if err := scanUser(row, &user); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return user, ErrUserNotFound
+		}
+		return user, err
+	}
+
+	// Все страны, предложенные api
+	query = "SELECT country_id, probability FROM public.user_nationalities WHERE user_id = $1 ORDER BY probability DESC"
+	rows, err := s.conn.Query(ctx, query, id)
+	if err != nil {
 		return user, err
 	}
-	return user, nil
+	defer rows.Close()
+
+	for rows.Next() {
+		var country models.Country
+		if err = rows.Scan(&country.Country_id, &country.Probability); err != nil {
+			return user, err
+		}
+		user.Nationalities = append(user.Nationalities, country)
+	}
+
+	if err = rows.Err(); err != nil {
+		return user, err
+	}
+
+	// Источники значений полей
+	users := []models.User{user}
+	if err = s.loadSources(ctx, users); err != nil {
+		return user, err
+	}
+	return users[0], nil
 }
 
 // Обновление данных конкретного пользователя по ID
-func (s *storage) EditUser(ctx context.Context, id int, getUserName string, getUserSurname string, getUserPatronymic string) error {
-	query := "UPDATE public.users SET name = $1, surname = $2, patronymic = $3 WHERE id = $4"
-	_, err := s.conn.Exec(ctx, query, getUserName, getUserSurname, getUserPatronymic, id)
+func (s *storage) EditUser(ctx context.Context, id int, edit models.UserEdit) error {
+	tx, err := s.conn.Begin(ctx)
 	if err != nil {
 		return err
 	}
-	return nil
+	defer tx.Rollback(ctx)
+
+	// Уверенность api к заданным вручную значениям не относится - сбрасываем ее
+	query := `UPDATE public.users SET
+		name = COALESCE(NULLIF($2, ''), name),
+		surname = COALESCE(NULLIF($3, ''), surname),
+		patronymic = COALESCE(NULLIF($4, ''), patronymic),
+		age = COALESCE(NULLIF($5, 0), age),
+		age_count = CASE WHEN $5 <> 0 THEN NULL ELSE age_count END,
+		age_country = CASE WHEN $5 <> 0 THEN NULL ELSE age_country END,
+		gender = COALESCE(NULLIF($6, ''), gender),
+		gender_probability = CASE WHEN $6 <> '' THEN NULL ELSE gender_probability END,
+		gender_country = CASE WHEN $6 <> '' THEN NULL ELSE gender_country END,
+		gender_mismatch = CASE WHEN $6 <> '' THEN false ELSE gender_mismatch END,
+		nation = COALESCE(NULLIF($7, ''), nation),
+		nation_probability = CASE WHEN $7 <> '' THEN NULL ELSE nation_probability END
+		WHERE id = $1`
+	tag, err := tx.Exec(ctx, query, id, edit.Name, edit.Surname, edit.Patronymic, edit.Age, edit.Gender, edit.Nation)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	// Измененные поля считаются заданными вручную - api их больше не меняет
+	fields := updatedFields(models.EnrichmentUpdate{Age: edit.Age, Gender: edit.Gender, Nation: edit.Nation})
+	if len(fields) > 0 {
+		if _, err = tx.Exec(ctx, upsertSourcesQuery, id, fields, models.SourceManual, edit.Editor); err != nil {
+			return err
+		}
+	}
+	if edit.Nation != "" {
+		if err = replaceNationalities(ctx, tx, id, edit.Nation); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Ошибка нарушения уникальности - например, пользователь с таким ФИО уже есть
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
 }
 
 func New(conn *pgxpool.Pool) Storage {
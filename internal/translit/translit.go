@@ -0,0 +1,102 @@
+package translit
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Система транслитерации кириллицы
+type Scheme string
+
+const (
+	// Без транслитерации
+	None Scheme = ""
+	// ГОСТ 7.79-2000, система Б - без апострофов для ъ и ь, которые api имен не распознают
+	GOST Scheme = "gost"
+	// ICAO Doc 9303 - как в загранпаспортах
+	ICAO Scheme = "icao"
+)
+
+// Замены для букв в нижнем регистре
+var tables = map[Scheme]map[rune]string{
+	GOST: {
+		'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh", 'з': "z", 'и': "i",
+		'й': "j", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t",
+		'у': "u", 'ф': "f", 'х': "x", 'ц': "c", 'ч': "ch", 'ш': "sh", 'щ': "shh", 'ъ': "", 'ы': "y", 'ь': "",
+		'э': "e", 'ю': "yu", 'я': "ya",
+	},
+	ICAO: {
+		'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh", 'з': "z", 'и': "i",
+		'й': "i", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t",
+		'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "ie", 'ы': "y", 'ь': "",
+		'э': "e", 'ю': "iu", 'я': "ia",
+	},
+}
+
+// Проверка названия системы из настроек
+func ParseScheme(name string) (Scheme, error) {
+	scheme := Scheme(strings.ToLower(strings.TrimSpace(name)))
+	if scheme == None {
+		return None, nil
+	}
+	if _, ok := tables[scheme]; !ok {
+		return None, fmt.Errorf("unknown transliteration scheme %q, available: %s, %s", name, GOST, ICAO)
+	}
+	return scheme, nil
+}
+
+// Есть ли в строке кириллица
+func HasCyrillic(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.Cyrillic, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Транслитерация строки, остальные символы не меняются
+func Transliterate(s string, scheme Scheme) string {
+	table, ok := tables[scheme]
+	if !ok {
+		return s
+	}
+
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		lower := unicode.ToLower(r)
+		latin, ok := table[lower]
+		if !ok {
+			b.WriteRune(r)
+			continue
+		}
+
+		// ГОСТ: ц перед и, е, ы, й передается как cz
+		if scheme == GOST && lower == 'ц' && i+1 < len(runes) && strings.ContainsRune("иеый", unicode.ToLower(runes[i+1])) {
+			latin = "cz"
+		}
+
+		if r != lower && latin != "" {
+			if upperWord(runes, i) {
+				// Слово заглавными буквами - замена тоже целиком заглавная
+				latin = strings.ToUpper(latin)
+			} else {
+				// Заглавная буква - заглавной становится первая буква замены
+				latin = strings.ToUpper(latin[:1]) + latin[1:]
+			}
+		}
+		b.WriteString(latin)
+	}
+
+	return b.String()
+}
+
+// Соседняя буква тоже заглавная - значит, все слово написано заглавными
+func upperWord(runes []rune, i int) bool {
+	if i+1 < len(runes) && unicode.IsLetter(runes[i+1]) {
+		return unicode.IsUpper(runes[i+1])
+	}
+	return i > 0 && unicode.IsUpper(runes[i-1])
+}
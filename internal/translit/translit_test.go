@@ -0,0 +1,98 @@
+package translit
+
+import "testing"
+
+func TestTransliterate(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		scheme Scheme
+		want   string
+	}{
+		{name: "none keeps cyrillic", input: "Иван", scheme: None, want: "Иван"},
+		{name: "latin is unchanged", input: "Ivan", scheme: ICAO, want: "Ivan"},
+
+		{name: "icao simple", input: "Иван", scheme: ICAO, want: "Ivan"},
+		{name: "icao kh", input: "Михаил", scheme: ICAO, want: "Mikhail"},
+		{name: "icao ts", input: "Цветков", scheme: ICAO, want: "Tsvetkov"},
+		{name: "icao shch", input: "Щукин", scheme: ICAO, want: "Shchukin"},
+		{name: "icao short i", input: "Андрей", scheme: ICAO, want: "Andrei"},
+		{name: "icao yo as e", input: "Пётр", scheme: ICAO, want: "Petr"},
+		{name: "icao iu ia", input: "Юлия", scheme: ICAO, want: "Iuliia"},
+		{name: "icao hard sign", input: "Подъячев", scheme: ICAO, want: "Podieiachev"},
+		{name: "icao soft sign dropped", input: "Игорь", scheme: ICAO, want: "Igor"},
+
+		{name: "gost simple", input: "Иван", scheme: GOST, want: "Ivan"},
+		{name: "gost x", input: "Михаил", scheme: GOST, want: "Mixail"},
+		{name: "gost c before consonant", input: "Цветков", scheme: GOST, want: "Cvetkov"},
+		{name: "gost cz before i", input: "Цимбал", scheme: GOST, want: "Czimbal"},
+		{name: "gost cz before e", input: "Лукреция", scheme: GOST, want: "Lukrecziya"},
+		{name: "gost cz before y", input: "Цыганов", scheme: GOST, want: "Czyganov"},
+		{name: "gost c at end", input: "Кузнец", scheme: GOST, want: "Kuznec"},
+		{name: "gost cz before capital", input: "ЦИМБАЛ", scheme: GOST, want: "CZIMBAL"},
+		{name: "gost shh", input: "Щукин", scheme: GOST, want: "Shhukin"},
+		{name: "gost short j", input: "Андрей", scheme: GOST, want: "Andrej"},
+		{name: "gost yo", input: "Пётр", scheme: GOST, want: "Pyotr"},
+
+		{name: "capital multi-letter replacement", input: "Жанна", scheme: ICAO, want: "Zhanna"},
+		{name: "lowercase", input: "жанна", scheme: ICAO, want: "zhanna"},
+		{name: "all caps", input: "ЩУКИН", scheme: ICAO, want: "SHCHUKIN"},
+		{name: "all caps last letter", input: "ЮЛИЯ", scheme: ICAO, want: "IULIIA"},
+		{name: "single capital letter", input: "Я", scheme: ICAO, want: "Ia"},
+		{name: "capital soft sign", input: "ИГОРЬ", scheme: ICAO, want: "IGOR"},
+		{name: "hyphenated", input: "Анна-Мария", scheme: ICAO, want: "Anna-Mariia"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Transliterate(tt.input, tt.scheme); got != tt.want {
+				t.Errorf("Transliterate(%q, %q) = %q, want %q", tt.input, tt.scheme, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScheme(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Scheme
+		wantErr bool
+	}{
+		{input: "", want: None},
+		{input: "icao", want: ICAO},
+		{input: " GOST ", want: GOST},
+		{input: "bgn", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseScheme(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseScheme(%q) error = %v, want error %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseScheme(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasCyrillic(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{input: "Иван", want: true},
+		{input: "Ivan", want: false},
+		{input: "Ivan Иван", want: true},
+		{input: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := HasCyrillic(tt.input); got != tt.want {
+				t.Errorf("HasCyrillic(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
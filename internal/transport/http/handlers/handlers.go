@@ -2,11 +2,15 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Yury132/Golang-Task-4/internal/models"
 	"github.com/Yury132/Golang-Task-4/internal/service"
@@ -15,22 +19,40 @@ import (
 )
 
 type Service interface {
-	// Получение всех пользователей БД
-	GetUsersList(ctx context.Context) ([]models.User, error)
-	// Получение определенных пользователей по возрасту
-	GetUsersListAge(ctx context.Context, userAgeMin int, userAgeMax int) ([]models.User, error)
-	// Получение определенных пользователей по полу
-	GetUsersListGender(ctx context.Context, gender string) ([]models.User, error)
-	// Получение определенных пользователей по национальности
-	GetUsersListNation(ctx context.Context, userNation string) ([]models.User, error)
-	// Добавление нового пользователя, если точно такой же уже не существует в БД
+	// Страница пользователей БД, подходящих под фильтр
+	GetUsersList(ctx context.Context, filter models.UserFilter, page models.PageRequest) (models.UserPage, error)
+	// Поиск пользователей по части ФИО, в том числе с опечатками
+	SearchUsers(ctx context.Context, query string) ([]models.SearchResult, error)
+	// Добавление нового пользователя, ErrDuplicate - пользователь с таким ФИО уже есть
 	HandleUser(ctx context.Context, name string, surname string, patronymic string) error
+	// Массовое добавление пользователей с пакетными запросами к api
+	ImportUsers(ctx context.Context, users []models.User) (models.ImportResult, error)
 	// Удаление пользователя
 	DeleteUser(ctx context.Context, id int) error
 	// Получение конкретного пользователя по ID
 	GetUser(ctx context.Context, id int) (models.User, error)
 	// Обновление данных конкретного пользователя по ID
-	EditUser(ctx context.Context, id int, getUserName string, getUserSurname string, getUserPatronymic string) error
+	EditUser(ctx context.Context, id int, edit models.UserEdit) error
+	// Состояние клиента внешних api
+	GetAPIStatus() models.APIStatus
+	// Удаление сохраненных результатов api для имени
+	InvalidateName(ctx context.Context, name string) (bool, error)
+	// Повторное обогащение пользователей свежими данными api
+	ReenrichUsers(ctx context.Context, opts models.ReenrichOptions) (models.ReenrichResult, error)
+	// Пользователи, результаты api для которых нужно проверить
+	GetReviewQueue(ctx context.Context) ([]models.User, error)
+	// Проверка пользователя оператором: подтверждение или исправление полей
+	ReviewUser(ctx context.Context, id int, values models.ReviewValues) error
+	// Порог вероятности, ниже которого результаты api проверяются оператором
+	ReviewThreshold() float64
+	// Пол и национальность для имен, накопленные из исправлений операторов
+	ListNameStats(ctx context.Context) ([]models.NameStat, error)
+	// Возможные дубликаты - пары пользователей с почти совпадающими ФИО
+	FindDuplicates(ctx context.Context) ([]models.DuplicatePair, error)
+	// Слияние двух пользователей в одного с выбором значения каждого поля
+	MergeUsers(ctx context.Context, merge models.MergeRequest) error
+	// Журнал слияний
+	ListMerges(ctx context.Context) ([]models.Merge, error)
 }
 
 type Handler struct {
@@ -38,27 +60,48 @@ type Handler struct {
 	service Service
 }
 
-// Все пользователи в БД
+// Данные для стартовой страницы
+type usersPage struct {
+	Users []models.User
+	// Значения формы фильтра, чтобы показать примененные условия
+	Form url.Values
+	// Ссылки на соседние страницы с теми же условиями, пусто - страницы нет
+	NextURL string
+	PrevURL string
+}
+
+// Страница пользователей в БД, подходящих под условия фильтра из формы.
+// Без условий показываются все пользователи
 func (h *Handler) GetUsersList(w http.ResponseWriter, r *http.Request) {
-	//w.Header().Set("Content-Type", "application/json")
 
-	h.log.Log().Msg("Получение всех пользователей")
+	h.log.Log().Msg("Получение пользователей")
 
-	users, err := h.service.GetUsersList(r.Context())
+	filter, page, err := parseUsersQuery(r)
+	if err != nil {
+		h.log.Error().Err(err).Msg("failed to parse users filter")
+		http.Redirect(w, r, "/users-list", http.StatusSeeOther)
+		return
+	}
+
+	result, err := h.service.GetUsersList(r.Context(), filter, page)
+	if errors.Is(err, service.ErrInvalidField) || errors.Is(err, service.ErrInvalidCursor) {
+		h.log.Error().Err(err).Msg("invalid users filter")
+		http.Redirect(w, r, "/users-list", http.StatusSeeOther)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		h.log.Error().Err(err).Msg("failed to get users list")
 		return
 	}
 
-	// data, err := json.Marshal(users)
-	// if err != nil {
-	// 	w.WriteHeader(http.StatusInternalServerError)
-	// 	h.log.Error().Err(err).Msg("failed to marshal users list")
-	// 	return
-	// }
-
-	// w.Write(data)
+	data := usersPage{Users: result.Users, Form: r.Form}
+	if result.Next != "" {
+		data.NextURL = pageURL(r.Form, "after", result.Next)
+	}
+	if result.Prev != "" {
+		data.PrevURL = pageURL(r.Form, "before", result.Prev)
+	}
 
 	tmpl, err := template.ParseFiles("./internal/templates/start.html")
 	if err != nil {
@@ -66,122 +109,202 @@ func (h *Handler) GetUsersList(w http.ResponseWriter, r *http.Request) {
 		h.log.Error().Err(err).Msg("failed to show start page")
 		return
 	}
-	tmpl.Execute(w, users)
+	tmpl.Execute(w, data)
 }
 
-// Получение определенных пользователей по возрасту
-func (h *Handler) GetUsersListAge(w http.ResponseWriter, r *http.Request) {
-
-	h.log.Log().Msg("Получение определенных пользователей по возрасту")
+// Страница пользователей в JSON с теми же параметрами, что и у /users-list
+func (h *Handler) GetUsersListJSON(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
-	// Минимальный возраст из формы POST запрос
-	userAgeMin, err := strconv.Atoi(r.FormValue("userAgeMin"))
-	if err != nil || userAgeMin < 0 {
-		h.log.Error().Err(err).Msg("failed to get min age")
-		http.Redirect(w, r, "/users-list", http.StatusSeeOther)
+	filter, page, err := parseUsersQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		h.log.Error().Err(err).Msg("failed to parse users filter")
 		return
 	}
 
-	// Максимальный возраст из формы POST запрос
-	userAgeMax, err := strconv.Atoi(r.FormValue("userAgeMax"))
-	if err != nil || userAgeMax < 0 {
-		h.log.Error().Err(err).Msg("failed to get max age")
-		http.Redirect(w, r, "/users-list", http.StatusSeeOther)
+	result, err := h.service.GetUsersList(r.Context(), filter, page)
+	if errors.Is(err, service.ErrInvalidField) || errors.Is(err, service.ErrInvalidCursor) {
+		w.WriteHeader(http.StatusBadRequest)
+		h.log.Error().Err(err).Msg("invalid users filter")
 		return
 	}
-
-	// Получаем пользователей
-	users, err := h.service.GetUsersListAge(r.Context(), userAgeMin, userAgeMax)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		h.log.Error().Err(err).Msg("failed to get Users List Age")
+		h.log.Error().Err(err).Msg("failed to get users list")
 		return
 	}
 
-	// Отображаем
-	tmpl, err := template.ParseFiles("./internal/templates/start.html")
+	data, err := json.Marshal(result)
 	if err != nil {
-		h.log.Error().Err(err).Msg("failed to show start page")
 		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to marshal users list")
 		return
 	}
-	tmpl.Execute(w, users)
+
+	w.Write(data)
 }
 
-// Получение определенных пользователей по полу
-func (h *Handler) GetUsersListGender(w http.ResponseWriter, r *http.Request) {
+// Данные для страницы поиска
+type searchPage struct {
+	Query   string
+	Results []models.SearchResult
+}
 
-	h.log.Log().Msg("Получение определенных пользователей по полу")
+// Поиск пользователей по ФИО из строки поиска на стартовой странице
+func (h *Handler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.FormValue("q"))
 
-	vars := mux.Vars(r)
-	// Мужчины или женщины
-	gender, err := strconv.Atoi(vars["gender"])
-	if err != nil {
-		h.log.Error().Err(err).Msg("failed to get gender")
+	h.log.Log().Msg(fmt.Sprintf("Поиск пользователей: %v", query))
+
+	results, err := h.service.SearchUsers(r.Context(), query)
+	if errors.Is(err, service.ErrInvalidField) {
+		h.log.Error().Err(err).Msg("invalid search query")
 		http.Redirect(w, r, "/users-list", http.StatusSeeOther)
 		return
 	}
-
-	// Определяем необходимый пол
-	var getGender string
-	if gender == 1 {
-		getGender = "м"
-	} else {
-		getGender = "ж"
-	}
-
-	// Получаем пользователей
-	users, err := h.service.GetUsersListGender(r.Context(), getGender)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		h.log.Error().Err(err).Msg("failed to get Users List Gender")
+		h.log.Error().Err(err).Msg("failed to search users")
 		return
 	}
 
-	// Отображаем
-	tmpl, err := template.ParseFiles("./internal/templates/start.html")
+	tmpl, err := template.ParseFiles("./internal/templates/search.html")
 	if err != nil {
-		h.log.Error().Err(err).Msg("failed to show start page")
 		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to show search page")
 		return
 	}
-	tmpl.Execute(w, users)
+	tmpl.Execute(w, searchPage{Query: query, Results: results})
 }
 
-// Получение определенных пользователей по национальности
-func (h *Handler) GetUsersListNation(w http.ResponseWriter, r *http.Request) {
+// Поиск пользователей по ФИО в JSON
+func (h *Handler) SearchUsersJSON(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
-	h.log.Log().Msg("Получение определенных пользователей по национальности")
-
-	// Национальность из формы POST запрос
-	userNation := r.FormValue("userNation")
-	if userNation == "" {
-		h.log.Log().Msg("Национальность пустая при фильтрации")
-		// Переадресуем пользователя на ту же страницу
-		http.Redirect(w, r, "/users-list", http.StatusSeeOther)
+	results, err := h.service.SearchUsers(r.Context(), r.FormValue("q"))
+	if errors.Is(err, service.ErrInvalidField) {
+		w.WriteHeader(http.StatusBadRequest)
+		h.log.Error().Err(err).Msg("invalid search query")
 		return
 	}
-
-	// К верхнему регистру
-	userNation = strings.ToUpper(userNation)
-
-	// Получаем пользователей
-	users, err := h.service.GetUsersListNation(r.Context(), userNation)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		h.log.Error().Err(err).Msg("failed to get Users List Nation")
+		h.log.Error().Err(err).Msg("failed to search users")
 		return
 	}
 
-	// Отображаем
-	tmpl, err := template.ParseFiles("./internal/templates/start.html")
+	data, err := json.Marshal(results)
 	if err != nil {
-		h.log.Error().Err(err).Msg("failed to show start page")
 		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to marshal search results")
 		return
 	}
 
-	tmpl.Execute(w, users)
+	w.Write(data)
+}
+
+// Адрес соседней страницы: те же условия и сортировка, другой курсор
+func pageURL(form url.Values, key string, cursor string) string {
+	query := make(url.Values, len(form))
+	for name, values := range form {
+		query[name] = values
+	}
+	query.Del("after")
+	query.Del("before")
+	query.Set(key, cursor)
+
+	return "/users-list?" + query.Encode()
+}
+
+// Фильтр и страница из параметров запроса
+func parseUsersQuery(r *http.Request) (models.UserFilter, models.PageRequest, error) {
+	filter, err := parseUserFilter(r)
+	if err != nil {
+		return filter, models.PageRequest{}, err
+	}
+
+	page, err := parsePageRequest(r)
+	return filter, page, err
+}
+
+// Страница списка из формы: sort (id, surname, age, nation), order (asc, desc), limit, after и before - курсоры
+func parsePageRequest(r *http.Request) (models.PageRequest, error) {
+	page := models.PageRequest{
+		Sort:   r.FormValue("sort"),
+		After:  r.FormValue("after"),
+		Before: r.FormValue("before"),
+	}
+
+	switch order := r.FormValue("order"); order {
+	case "", "asc":
+	case "desc":
+		page.Desc = true
+	default:
+		return page, fmt.Errorf("unknown order %q", order)
+	}
+
+	if value := r.FormValue("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return page, err
+		}
+		page.Limit = limit
+	}
+
+	return page, nil
+}
+
+// Формат дат в фильтре пользователей
+const filterDateLayout = "2006-01-02"
+
+// Условия фильтра пользователей из формы, незаполненные поля не применяются:
+// ageMin, ageMax, gender, nation (несколько кодов через запятую), nationProbability,
+// name, createdFrom и createdTo (даты включительно)
+func parseUserFilter(r *http.Request) (models.UserFilter, error) {
+	var (
+		filter models.UserFilter
+		err    error
+	)
+
+	if value := r.FormValue("ageMin"); value != "" {
+		if filter.AgeMin, err = strconv.Atoi(value); err != nil {
+			return filter, err
+		}
+	}
+	if value := r.FormValue("ageMax"); value != "" {
+		if filter.AgeMax, err = strconv.Atoi(value); err != nil {
+			return filter, err
+		}
+	}
+
+	filter.Gender = r.FormValue("gender")
+	filter.Name = r.FormValue("name")
+
+	if value := r.FormValue("nation"); value != "" {
+		filter.Nations = strings.FieldsFunc(value, func(c rune) bool { return c == ',' || c == ' ' })
+	}
+	if value := r.FormValue("nationProbability"); value != "" {
+		if filter.MinNationProbability, err = strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := r.FormValue("createdFrom"); value != "" {
+		if filter.CreatedFrom, err = time.ParseInLocation(filterDateLayout, value, time.Local); err != nil {
+			return filter, err
+		}
+	}
+	if value := r.FormValue("createdTo"); value != "" {
+		createdTo, err := time.ParseInLocation(filterDateLayout, value, time.Local)
+		if err != nil {
+			return filter, err
+		}
+		// Дата "по" включается целиком
+		filter.CreatedTo = createdTo.AddDate(0, 0, 1)
+	}
+
+	return filter, nil
 }
 
 // Удаление пользователя по ID
@@ -240,17 +363,68 @@ func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Добавляем нового пользователя, проверяя при этом его существование в БД
+	// Добавляем нового пользователя, если пользователя с таким ФИО еще нет
 	err := h.service.HandleUser(r.Context(), getUserName, getUserSurname, getUserPatronymic)
+	if errors.Is(err, service.ErrDuplicate) {
+		h.log.Log().Msg("Пользователь с таким ФИО уже существует")
+		http.Redirect(w, r, "/users-list", http.StatusSeeOther)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		h.log.Error().Err(err).Msg("failed to Create User")
+		return
 	}
 
 	// Переадресуем пользователя на ту же страницу
 	http.Redirect(w, r, "/users-list", http.StatusSeeOther)
 }
 
+// Массовое добавление пользователей из JSON массива [{"name", "surname", "patronymic"}],
+// возраст, пол и национальность можно передать сразу - они не будут запрошены у api
+func (h *Handler) ImportUsers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	h.log.Log().Msg("Массовое добавление пользователей")
+
+	var users []models.User
+	if err := json.NewDecoder(r.Body).Decode(&users); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		h.log.Error().Err(err).Msg("failed to decode users to import")
+		return
+	}
+
+	// ФИО должно быть заполнено полностью
+	for i, user := range users {
+		if user.Name == "" || user.Surname == "" || user.Patronymic == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			h.log.Log().Msg(fmt.Sprintf("ФИО пользователя №%v заполнено не полностью при импорте", i+1))
+			return
+		}
+	}
+
+	result, err := h.service.ImportUsers(r.Context(), users)
+	if errors.Is(err, service.ErrInvalidField) {
+		w.WriteHeader(http.StatusBadRequest)
+		h.log.Error().Err(err).Msg("failed to import users")
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to import users")
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to marshal import result")
+		return
+	}
+
+	w.Write(data)
+}
+
 // Переход к конкретному пользователю по ID
 func (h *Handler) GoUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -324,19 +498,511 @@ func (h *Handler) EditUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Возраст из формы, пустое значение оставляет прежний
+	var getUserAge int
+	if value := strings.TrimSpace(r.FormValue("userAge")); value != "" {
+		getUserAge, err = strconv.Atoi(value)
+		if err != nil {
+			h.log.Log().Msg("Возраст пользователя не число при редактировании")
+			http.Redirect(w, r, "/go-user/"+r.FormValue("userID"), http.StatusSeeOther)
+			return
+		}
+	}
+
+	edit := models.UserEdit{
+		Name:       getUserName,
+		Surname:    getUserSurname,
+		Patronymic: getUserPatronymic,
+		Age:        getUserAge,
+		Gender:     r.FormValue("userGender"),
+		Nation:     r.FormValue("userNation"),
+		Editor:     r.FormValue("editor"),
+	}
+
 	h.log.Log().Msg(fmt.Sprintf("Edit user with ID=%v", userId))
 
 	// Обновляем данные
-	err = h.service.EditUser(r.Context(), userId, getUserName, getUserSurname, getUserPatronymic)
-	if err != nil {
+	err = h.service.EditUser(r.Context(), userId, edit)
+	if errors.Is(err, service.ErrInvalidField) {
+		// Неверные значения полей - возвращаем на ту же страницу
+		h.log.Log().Msg(fmt.Sprintf("Неверные данные при редактировании: %v", err))
+	} else if errors.Is(err, service.ErrDuplicate) {
+		h.log.Log().Msg("Пользователь с таким ФИО уже существует")
+	} else if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		h.log.Error().Err(err).Msg("failed to Edit User")
+		return
 	}
 
 	http.Redirect(w, r, "/go-user/"+r.FormValue("userID"), http.StatusSeeOther)
 
 }
 
+// Состояние клиента внешних api
+func (h *Handler) GetAPIStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	data, err := json.Marshal(h.service.GetAPIStatus())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to marshal api status")
+		return
+	}
+
+	w.Write(data)
+}
+
+// Удаление сохраненных результатов api для имени
+func (h *Handler) InvalidateName(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	h.log.Log().Msg(fmt.Sprintf("Удаление сохраненных результатов api для имени %v", name))
+
+	deleted, err := h.service.InvalidateName(r.Context(), name)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to invalidate name enrichment")
+		return
+	}
+
+	if !deleted {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Повторное обогащение пользователей, параметры - JSON models.ReenrichOptions
+func (h *Handler) ReenrichUsers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var opts models.ReenrichOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		h.log.Error().Err(err).Msg("failed to decode reenrich options")
+		return
+	}
+
+	h.log.Log().Msg(fmt.Sprintf("Повторное обогащение пользователей: %+v", opts))
+
+	result, err := h.service.ReenrichUsers(r.Context(), opts)
+	if errors.Is(err, service.ErrReenrichNoFilter) {
+		w.WriteHeader(http.StatusBadRequest)
+		h.log.Error().Err(err).Msg("failed to reenrich users")
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to reenrich users")
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to marshal reenrich result")
+		return
+	}
+
+	w.Write(data)
+}
+
+// Изменение пользователя, значения полей - JSON models.UserEdit, пустые значения не меняют поле
+func (h *Handler) EditUserJSON(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userId, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		h.log.Error().Err(err).Msg("failed to get user to edit")
+		return
+	}
+
+	var edit models.UserEdit
+	if err = json.NewDecoder(r.Body).Decode(&edit); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		h.log.Error().Err(err).Msg("failed to decode user edit")
+		return
+	}
+
+	h.log.Log().Msg(fmt.Sprintf("Edit user with ID=%v", userId))
+
+	err = h.service.EditUser(r.Context(), userId, edit)
+	if errors.Is(err, service.ErrInvalidField) {
+		w.WriteHeader(http.StatusBadRequest)
+		h.log.Error().Err(err).Msg("failed to Edit User")
+		return
+	}
+	if errors.Is(err, service.ErrUserNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, service.ErrDuplicate) {
+		w.WriteHeader(http.StatusConflict)
+		h.log.Error().Err(err).Msg("failed to Edit User")
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to Edit User")
+		return
+	}
+
+	// Возвращаем пользователя после изменения
+	user, err := h.service.GetUser(r.Context(), userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to get user by ID")
+		return
+	}
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to marshal user")
+		return
+	}
+
+	w.Write(data)
+}
+
+// Данные страницы проверки результатов api
+type reviewPage struct {
+	Users     []models.User
+	Threshold float64
+	// Почему не сохранена последняя проверка
+	Error string
+}
+
+// Страница с пользователями, результаты api для которых нужно проверить
+func (h *Handler) GetReviewQueue(w http.ResponseWriter, r *http.Request) {
+	users, err := h.service.GetReviewQueue(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to get review queue")
+		return
+	}
+
+	tmpl, err := template.ParseFiles("./internal/templates/review.html")
+	if err != nil {
+		h.log.Error().Err(err).Msg("failed to show review page")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// Передаем данные
+	tmpl.Execute(w, reviewPage{Users: users, Threshold: h.service.ReviewThreshold(), Error: r.URL.Query().Get("error")})
+}
+
+// Проверка пользователя оператором из формы
+func (h *Handler) ReviewUser(w http.ResponseWriter, r *http.Request) {
+
+	// ID пользователя
+	userId, err := strconv.Atoi(r.FormValue("userID"))
+	if err != nil || userId < 0 {
+		h.log.Error().Err(err).Msg("failed to get user to review")
+		http.Redirect(w, r, "/review", http.StatusSeeOther)
+		return
+	}
+
+	// Возраст из формы, пустое значение не пройдет проверку в сервисе
+	age, _ := strconv.Atoi(strings.TrimSpace(r.FormValue("userAge")))
+
+	values := models.ReviewValues{
+		Reviewer: r.FormValue("reviewer"),
+		Age:      age,
+		Gender:   r.FormValue("userGender"),
+		Nation:   r.FormValue("userNation"),
+	}
+
+	h.log.Log().Msg(fmt.Sprintf("Проверка пользователя с ID=%v", userId))
+
+	err = h.service.ReviewUser(r.Context(), userId, values)
+	if errors.Is(err, service.ErrInvalidField) || errors.Is(err, service.ErrNoReviewer) || errors.Is(err, service.ErrUserNotFound) {
+		// Неверные данные - возвращаем на страницу проверки с сообщением
+		h.log.Log().Msg(fmt.Sprintf("Неверные данные при проверке: %v", err))
+		message := fmt.Sprintf("Проверка пользователя с ID=%v не сохранена: %v", userId, err)
+		http.Redirect(w, r, "/review?error="+url.QueryEscape(message), http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to review user")
+		return
+	}
+
+	http.Redirect(w, r, "/review", http.StatusSeeOther)
+}
+
+// Пользователи, результаты api для которых нужно проверить, в JSON
+func (h *Handler) GetReviewQueueJSON(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	users, err := h.service.GetReviewQueue(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to get review queue")
+		return
+	}
+
+	data, err := json.Marshal(users)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to marshal review queue")
+		return
+	}
+
+	w.Write(data)
+}
+
+// Проверка пользователя оператором, значения полей - JSON models.ReviewValues
+func (h *Handler) ReviewUserJSON(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		h.log.Error().Err(err).Msg("failed to get user to review")
+		return
+	}
+
+	var values models.ReviewValues
+	if err = json.NewDecoder(r.Body).Decode(&values); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		h.log.Error().Err(err).Msg("failed to decode review")
+		return
+	}
+
+	h.log.Log().Msg(fmt.Sprintf("Проверка пользователя с ID=%v", userId))
+
+	err = h.service.ReviewUser(r.Context(), userId, values)
+	if errors.Is(err, service.ErrInvalidField) || errors.Is(err, service.ErrNoReviewer) {
+		w.WriteHeader(http.StatusBadRequest)
+		h.log.Error().Err(err).Msg("failed to review user")
+		return
+	}
+	if errors.Is(err, service.ErrUserNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to review user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Страница со значениями для имен, накопленными из исправлений операторов
+func (h *Handler) GetNameStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.service.ListNameStats(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to get name stats")
+		return
+	}
+
+	tmpl, err := template.ParseFiles("./internal/templates/name_stats.html")
+	if err != nil {
+		h.log.Error().Err(err).Msg("failed to show name stats page")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// Передаем данные
+	tmpl.Execute(w, stats)
+}
+
+// Значения для имен, накопленные из исправлений операторов, в JSON
+func (h *Handler) GetNameStatsJSON(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	stats, err := h.service.ListNameStats(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to get name stats")
+		return
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to marshal name stats")
+		return
+	}
+
+	w.Write(data)
+}
+
+// Значения поля у двух возможных дубликатов для выбора при слиянии
+type fieldChoice struct {
+	Field  string
+	Label  string
+	First  string
+	Second string
+}
+
+// Пара возможных дубликатов на странице слияния
+type duplicateView struct {
+	models.DuplicatePair
+	Fields []fieldChoice
+}
+
+// Поля пары, значения которых можно выбрать при слиянии
+func mergeChoices(pair models.DuplicatePair) []fieldChoice {
+	age := func(user models.User) string {
+		if user.Age == 0 {
+			return ""
+		}
+		return strconv.Itoa(user.Age)
+	}
+	return []fieldChoice{
+		{Field: models.FieldSurname, Label: "Фамилия", First: pair.First.Surname, Second: pair.Second.Surname},
+		{Field: models.FieldName, Label: "Имя", First: pair.First.Name, Second: pair.Second.Name},
+		{Field: models.FieldPatronymic, Label: "Отчество", First: pair.First.Patronymic, Second: pair.Second.Patronymic},
+		{Field: models.FieldAge, Label: "Возраст", First: age(pair.First), Second: age(pair.Second)},
+		{Field: models.FieldGender, Label: "Пол", First: pair.First.Gender, Second: pair.Second.Gender},
+		{Field: models.FieldNation, Label: "Национальность", First: pair.First.Nation, Second: pair.Second.Nation},
+	}
+}
+
+// Страница возможных дубликатов с формой слияния для каждой пары
+func (h *Handler) GetDuplicates(w http.ResponseWriter, r *http.Request) {
+	pairs, err := h.service.FindDuplicates(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to find duplicates")
+		return
+	}
+
+	views := make([]duplicateView, 0, len(pairs))
+	for _, pair := range pairs {
+		views = append(views, duplicateView{DuplicatePair: pair, Fields: mergeChoices(pair)})
+	}
+
+	tmpl, err := template.ParseFiles("./internal/templates/duplicates.html")
+	if err != nil {
+		h.log.Error().Err(err).Msg("failed to show duplicates page")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// Передаем данные
+	tmpl.Execute(w, views)
+}
+
+// Слияние пары из формы: keep - какой пользователь остается (first или second),
+// для каждого поля - у какого пользователя взять значение
+func (h *Handler) MergeUsers(w http.ResponseWriter, r *http.Request) {
+	firstID, err := strconv.Atoi(r.FormValue("firstID"))
+	if err != nil {
+		h.log.Error().Err(err).Msg("failed to get users to merge")
+		http.Redirect(w, r, "/duplicates", http.StatusSeeOther)
+		return
+	}
+	secondID, err := strconv.Atoi(r.FormValue("secondID"))
+	if err != nil {
+		h.log.Error().Err(err).Msg("failed to get users to merge")
+		http.Redirect(w, r, "/duplicates", http.StatusSeeOther)
+		return
+	}
+
+	merge := models.MergeRequest{KeepID: firstID, RemoveID: secondID, Merger: r.FormValue("merger")}
+	removed := "second"
+	if r.FormValue("keep") == "second" {
+		merge.KeepID, merge.RemoveID = secondID, firstID
+		removed = "first"
+	}
+	for _, field := range []string{models.FieldSurname, models.FieldName, models.FieldPatronymic,
+		models.FieldAge, models.FieldGender, models.FieldNation} {
+		if r.FormValue(field) == removed {
+			merge.Take = append(merge.Take, field)
+		}
+	}
+
+	h.log.Log().Msg(fmt.Sprintf("Слияние пользователей с ID=%v и ID=%v", merge.KeepID, merge.RemoveID))
+
+	if err = h.service.MergeUsers(r.Context(), merge); err != nil {
+		h.log.Error().Err(err).Msg("failed to merge users")
+	}
+
+	http.Redirect(w, r, "/duplicates", http.StatusSeeOther)
+}
+
+// Возможные дубликаты в JSON
+func (h *Handler) GetDuplicatesJSON(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	pairs, err := h.service.FindDuplicates(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to find duplicates")
+		return
+	}
+
+	data, err := json.Marshal(pairs)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to marshal duplicates")
+		return
+	}
+
+	w.Write(data)
+}
+
+// Слияние пользователей через JSON {"keep_id", "remove_id", "take", "merger"}
+func (h *Handler) MergeUsersJSON(w http.ResponseWriter, r *http.Request) {
+	var merge models.MergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&merge); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		h.log.Error().Err(err).Msg("failed to decode merge")
+		return
+	}
+
+	h.log.Log().Msg(fmt.Sprintf("Слияние пользователей с ID=%v и ID=%v", merge.KeepID, merge.RemoveID))
+
+	err := h.service.MergeUsers(r.Context(), merge)
+	if errors.Is(err, service.ErrInvalidField) || errors.Is(err, service.ErrNoMerger) {
+		w.WriteHeader(http.StatusBadRequest)
+		h.log.Error().Err(err).Msg("failed to merge users")
+		return
+	}
+	if errors.Is(err, service.ErrUserNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, service.ErrDuplicate) {
+		w.WriteHeader(http.StatusConflict)
+		h.log.Error().Err(err).Msg("failed to merge users")
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to merge users")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Журнал слияний в JSON
+func (h *Handler) GetMergesJSON(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	merges, err := h.service.ListMerges(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to get merges")
+		return
+	}
+
+	data, err := json.Marshal(merges)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		h.log.Error().Err(err).Msg("failed to marshal merges")
+		return
+	}
+
+	w.Write(data)
+}
+
 func New(log zerolog.Logger, service service.Service) *Handler {
 	return &Handler{
 		log:     log,
@@ -10,22 +10,47 @@ import (
 func InitRoutes(h *handlers.Handler) *mux.Router {
 	r := mux.NewRouter()
 
-	// Все пользователи в БД
+	// Пользователи в БД, подходящие под фильтр
 	r.HandleFunc("/users-list", h.GetUsersList)
-	// Получение определенных пользователей по возрасту
-	r.HandleFunc("/users-list-age", h.GetUsersListAge).Methods(http.MethodPost)
-	// Получение определенных пользователей по полу
-	r.HandleFunc("/users-list-gender/{gender:[0-9]+}", h.GetUsersListGender).Methods(http.MethodPost)
-	// Получение определенных пользователей по национальности
-	r.HandleFunc("/users-list-nation", h.GetUsersListNation).Methods(http.MethodPost)
+	r.HandleFunc("/api/users", h.GetUsersListJSON).Methods(http.MethodGet)
+	// Поиск пользователей по ФИО
+	r.HandleFunc("/search", h.SearchUsers).Methods(http.MethodGet)
+	r.HandleFunc("/api/search", h.SearchUsersJSON).Methods(http.MethodGet)
 	// Удаление пользователя по ID
 	r.HandleFunc("/delete-user/{userId:[0-9]+}", h.DeleteUser).Methods(http.MethodGet)
 	// Добавление нового пользователя, если точно такой же уже не существует в БД
 	r.HandleFunc("/create-user", h.CreateUser).Methods(http.MethodPost)
+	// Массовое добавление пользователей из JSON
+	r.HandleFunc("/import-users", h.ImportUsers).Methods(http.MethodPost)
 	// Переход к конкретному пользователю по ID
 	r.HandleFunc("/go-user/{userId:[0-9]+}", h.GoUser).Methods(http.MethodGet)
 	// Обновление данных конкретного пользователя по ID
 	r.HandleFunc("/edit-user", h.EditUser).Methods(http.MethodPost)
+	// Обновление данных пользователя через JSON, включая возраст, пол и национальность
+	r.HandleFunc("/api/users/{userId:[0-9]+}", h.EditUserJSON).Methods(http.MethodPut)
+	// Состояние клиента внешних api
+	r.HandleFunc("/api-status", h.GetAPIStatus).Methods(http.MethodGet)
+	// Удаление сохраненных результатов api для имени
+	r.HandleFunc("/admin/name-enrichment/{name}", h.InvalidateName).Methods(http.MethodDelete)
+	// Повторное обогащение пользователей
+	r.HandleFunc("/admin/reenrich", h.ReenrichUsers).Methods(http.MethodPost)
+
+	// Проверка результатов api операторами
+	r.HandleFunc("/review", h.GetReviewQueue).Methods(http.MethodGet)
+	r.HandleFunc("/review-user", h.ReviewUser).Methods(http.MethodPost)
+	r.HandleFunc("/api/review", h.GetReviewQueueJSON).Methods(http.MethodGet)
+	r.HandleFunc("/api/review/{userId:[0-9]+}", h.ReviewUserJSON).Methods(http.MethodPost)
+
+	// Значения для имен, накопленные из исправлений операторов
+	r.HandleFunc("/admin/name-stats", h.GetNameStats).Methods(http.MethodGet)
+	r.HandleFunc("/api/name-stats", h.GetNameStatsJSON).Methods(http.MethodGet)
+
+	// Поиск дубликатов и слияние пользователей
+	r.HandleFunc("/duplicates", h.GetDuplicates).Methods(http.MethodGet)
+	r.HandleFunc("/merge-users", h.MergeUsers).Methods(http.MethodPost)
+	r.HandleFunc("/api/duplicates", h.GetDuplicatesJSON).Methods(http.MethodGet)
+	r.HandleFunc("/api/merge", h.MergeUsersJSON).Methods(http.MethodPost)
+	r.HandleFunc("/api/merges", h.GetMergesJSON).Methods(http.MethodGet)
 
 	http.Handle("/", r)
 
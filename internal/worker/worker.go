@@ -0,0 +1,81 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type Service interface {
+	// Обогащение очередных пользователей, ожидающих обработки, возвращает их количество
+	EnrichPending(ctx context.Context, limit int) (int, error)
+}
+
+// Настройки фоновой обработки
+type Config struct {
+	// Количество одновременно работающих обработчиков
+	Workers int
+	// Сколько пользователей захватывает обработчик за раз
+	BatchSize int
+	// Пауза, если очередь пуста или произошла ошибка
+	PollInterval time.Duration
+}
+
+// Пул обработчиков очереди пользователей, ожидающих обогащения
+type Pool struct {
+	logger  zerolog.Logger
+	service Service
+	cfg     Config
+}
+
+// Запускаем обработчики и ждем их завершения после отмены ctx.
+// После отмены новые пользователи не захватываются, а уже захваченные обрабатываются до конца
+func (p *Pool) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < p.cfg.Workers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			p.work(ctx, id)
+		}(i + 1)
+	}
+	wg.Wait()
+}
+
+// Обрабатываем очередь, пока она не пуста, затем ждем новых пользователей
+func (p *Pool) work(ctx context.Context, id int) {
+	p.logger.Debug().Int("worker", id).Msg("enrichment worker started")
+
+	// Захваченная пачка не должна прерываться остановкой - иначе пользователи
+	// останутся захваченными до истечения аренды
+	batchCtx := context.WithoutCancel(ctx)
+
+	for ctx.Err() == nil {
+		processed, err := p.service.EnrichPending(batchCtx, p.cfg.BatchSize)
+		if err != nil {
+			p.logger.Error().Err(err).Int("worker", id).Msg("failed to enrich pending users")
+		}
+
+		// Очередь не пуста - сразу берем следующую пачку
+		if err == nil && processed > 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(p.cfg.PollInterval):
+		}
+	}
+
+	p.logger.Debug().Int("worker", id).Msg("enrichment worker stopped")
+}
+
+func New(logger zerolog.Logger, service Service, cfg Config) *Pool {
+	return &Pool{
+		logger:  logger,
+		service: service,
+		cfg:     cfg,
+	}
+}